@@ -0,0 +1,159 @@
+package accesslog
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatCombined = "combined" // Apache/NGINX combined log format
+	FormatLogfmt   = "logfmt"
+)
+
+// Stdout is the path writing the access log to the standard output, without rotation
+const Stdout = "-"
+
+// Config configures the access log
+type Config struct {
+	Path        string        `toml:"path" yaml:"path"`                 // File the log is written to, Stdout or empty to log requests with slog
+	Format      string        `toml:"format" yaml:"format"`             // FormatJSON, FormatCombined or FormatLogfmt
+	MaxSize     int64         `toml:"max_size" yaml:"max_size"`         // Size in bytes above which the file is rotated, 0 disables it
+	RotateEvery time.Duration `toml:"rotate_every" yaml:"rotate_every"` // Age of the file above which it is rotated, 0 disables it
+	MaxAge      time.Duration `toml:"max_age" yaml:"max_age"`           // Rotated files older than this are deleted, 0 keeps them
+	MaxBackups  int           `toml:"max_backups" yaml:"max_backups"`   // Rotated files kept beyond this number are deleted, 0 keeps them
+	Exclude     []string      `toml:"exclude" yaml:"exclude"`           // Path prefixes never logged (e.g. static assets)
+	Sample      []SampleRule  `toml:"sample" yaml:"sample"`             // Per path prefix sampling, the first matching rule wins
+}
+
+// Enabled reports whether requests are written to the access log rather than slog
+func (c Config) Enabled() bool {
+	return c.Path != ""
+}
+
+// SampleRule logs only a fraction of the successful requests whose path starts with PathPrefix
+type SampleRule struct {
+	PathPrefix string  `toml:"path_prefix" yaml:"path_prefix"`
+	Rate       float64 `toml:"rate" yaml:"rate"` // Between 0 (none) and 1 (all)
+}
+
+// ParseSampleRules parses rules written as prefix=rate, e.g. /js/=0.1
+func ParseSampleRules(values []string) ([]SampleRule, error) {
+	rules := make([]SampleRule, 0, len(values))
+	for _, value := range values {
+		prefix, rawRate, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid sample rule %q, expected prefix=rate", value)
+		}
+		rate, err := strconv.ParseFloat(rawRate, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid sample rate %q, expected a number between 0 and 1", rawRate)
+		}
+		rules = append(rules, SampleRule{PathPrefix: prefix, Rate: rate})
+	}
+	return rules, nil
+}
+
+// Entry describes a request once its response was written
+type Entry struct {
+	Time      time.Time
+	Method    string
+	URI       string
+	Proto     string
+	Route     string
+	Status    int
+	Bytes     int64
+	Duration  time.Duration
+	IP        string
+	Referrer  string
+	UserAgent string
+	RequestID string
+	UserID    string // Empty for anonymous requests
+}
+
+// Logger writes the entries of the sampled requests to the access log
+type Logger struct {
+	config Config
+	format formatter
+	mu     sync.Mutex
+	out    io.WriteCloser
+	buf    []byte
+}
+
+// New opens the access log, creating the file and its directory when needed
+func New(cfg Config) (*Logger, error) {
+	format, ok := formatters[cfg.Format]
+	if !ok {
+		return nil, fmt.Errorf("invalid access log format %q, expected %s, %s or %s", cfg.Format, FormatJSON, FormatCombined, FormatLogfmt)
+	}
+
+	var out io.WriteCloser = nopCloser{os.Stdout}
+	if cfg.Path != Stdout {
+		file, err := openRotatingFile(cfg)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+
+	return &Logger{config: cfg, format: format, out: out}, nil
+}
+
+// Log writes entry unless its path is excluded or it isn't sampled. Client
+// and server errors are always written.
+func (l *Logger) Log(entry Entry) {
+	if !l.sampled(entry) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = l.format(l.buf[:0], entry)
+	l.buf = append(l.buf, '\n')
+	if _, err := l.out.Write(l.buf); err != nil {
+		slog.Error("failed to write access log", "error", err)
+	}
+}
+
+// sampled reports whether entry is written
+func (l *Logger) sampled(entry Entry) bool {
+	path, _, _ := strings.Cut(entry.URI, "?")
+	for _, prefix := range l.config.Exclude {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	if entry.Status >= 400 {
+		return true
+	}
+	for _, rule := range l.config.Sample {
+		if strings.HasPrefix(path, rule.PathPrefix) {
+			return rand.Float64() < rule.Rate
+		}
+	}
+	return true
+}
+
+// Close flushes and closes the access log file
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.out.Close()
+}
+
+// nopCloser keeps the standard output open when the log is closed
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
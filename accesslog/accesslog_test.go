@@ -0,0 +1,143 @@
+package accesslog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testEntry = Entry{
+	Time:      time.Date(2025, 3, 14, 9, 26, 53, 500_000_000, time.UTC),
+	Method:    "GET",
+	URI:       "/users/42?tab=sessions",
+	Proto:     "HTTP/1.1",
+	Route:     "/users/{id}",
+	Status:    200,
+	Bytes:     1234,
+	Duration:  12345 * time.Microsecond,
+	IP:        "192.0.2.1",
+	Referrer:  "https://example.com/",
+	UserAgent: `Mozilla/5.0 "quoted"`,
+	RequestID: "req-1",
+	UserID:    "7",
+}
+
+func TestFormats(t *testing.T) {
+	anonymous := testEntry
+	anonymous.Bytes, anonymous.Referrer, anonymous.UserAgent, anonymous.UserID, anonymous.Route = 0, "", "", "", ""
+
+	tests := []struct {
+		format string
+		entry  Entry
+		want   string
+	}{
+		{
+			format: FormatJSON,
+			entry:  testEntry,
+			want:   `{"time":"2025-03-14T09:26:53.5Z","method":"GET","uri":"/users/42?tab=sessions","proto":"HTTP/1.1","route":"/users/{id}","status":200,"bytes":1234,"duration_ms":12.345,"ip":"192.0.2.1","referrer":"https://example.com/","user_agent":"Mozilla/5.0 \"quoted\"","request_id":"req-1","user_id":"7"}`,
+		},
+		{
+			format: FormatJSON,
+			entry:  anonymous,
+			want:   `{"time":"2025-03-14T09:26:53.5Z","method":"GET","uri":"/users/42?tab=sessions","proto":"HTTP/1.1","status":200,"bytes":0,"duration_ms":12.345,"ip":"192.0.2.1","request_id":"req-1"}`,
+		},
+		{
+			format: FormatCombined,
+			entry:  testEntry,
+			want:   `192.0.2.1 - 7 [14/Mar/2025:09:26:53 +0000] "GET /users/42?tab=sessions HTTP/1.1" 200 1234 "https://example.com/" "Mozilla/5.0 \"quoted\""`,
+		},
+		{
+			format: FormatCombined,
+			entry:  anonymous,
+			want:   `192.0.2.1 - - [14/Mar/2025:09:26:53 +0000] "GET /users/42?tab=sessions HTTP/1.1" 200 - "-" "-"`,
+		},
+		{
+			format: FormatLogfmt,
+			entry:  testEntry,
+			want:   `time=2025-03-14T09:26:53.5Z method=GET uri="/users/42?tab=sessions" proto=HTTP/1.1 route=/users/{id} status=200 bytes=1234 duration_ms=12.345 ip=192.0.2.1 referrer=https://example.com/ user_agent="Mozilla/5.0 \"quoted\"" request_id=req-1 user_id=7`,
+		},
+		{
+			format: FormatLogfmt,
+			entry:  anonymous,
+			want:   `time=2025-03-14T09:26:53.5Z method=GET uri="/users/42?tab=sessions" proto=HTTP/1.1 route="" status=200 bytes=0 duration_ms=12.345 ip=192.0.2.1 referrer="" user_agent="" request_id=req-1 user_id=""`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := string(formatters[tt.format](nil, tt.entry)); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsUnknownFormat(t *testing.T) {
+	if _, err := New(Config{Path: Stdout, Format: "xml"}); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestLoggerSampling(t *testing.T) {
+	cfg := Config{
+		Path:    filepath.Join(t.TempDir(), "access.log"),
+		Format:  FormatLogfmt,
+		Exclude: []string{"/healthz"},
+		Sample: []SampleRule{
+			{PathPrefix: "/js/", Rate: 0},
+			{PathPrefix: "/", Rate: 1},
+		},
+	}
+	logger, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []struct {
+		uri    string
+		status int
+		logged bool
+	}{
+		{uri: "/healthz", status: 200},
+		{uri: "/healthz?full", status: 500},
+		{uri: "/js/app.js", status: 200},
+		{uri: "/js/missing.js", status: 404, logged: true},
+		{uri: "/settings", status: 200, logged: true},
+	}
+	for _, e := range entries {
+		entry := testEntry
+		entry.URI, entry.Status = e.uri, e.status
+		logger.Log(entry)
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if logged := strings.Contains(string(data), "uri="+e.uri+" "); logged != e.logged {
+			t.Errorf("%s %d: logged = %v, want %v", e.uri, e.status, logged, e.logged)
+		}
+	}
+}
+
+func TestParseSampleRules(t *testing.T) {
+	rules, err := ParseSampleRules([]string{"/js/=0.1", "/=1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0] != (SampleRule{PathPrefix: "/js/", Rate: 0.1}) || rules[1] != (SampleRule{PathPrefix: "/", Rate: 1}) {
+		t.Errorf("rules = %v", rules)
+	}
+
+	for _, value := range []string{"/js/", "/js/=often", "/js/=1.5", "/js/=-0.1"} {
+		if _, err := ParseSampleRules([]string{value}); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatter appends the line of an entry to buf, without the trailing newline
+type formatter func(buf []byte, entry Entry) []byte
+
+var formatters = map[string]formatter{
+	FormatJSON:     formatJSON,
+	FormatCombined: formatCombined,
+	FormatLogfmt:   formatLogfmt,
+}
+
+// jsonEntry is the JSON representation of an entry, one object per line
+type jsonEntry struct {
+	Time       string  `json:"time"`
+	Method     string  `json:"method"`
+	URI        string  `json:"uri"`
+	Proto      string  `json:"proto"`
+	Route      string  `json:"route,omitempty"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMS float64 `json:"duration_ms"`
+	IP         string  `json:"ip"`
+	Referrer   string  `json:"referrer,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+	RequestID  string  `json:"request_id,omitempty"`
+	UserID     string  `json:"user_id,omitempty"`
+}
+
+func formatJSON(buf []byte, entry Entry) []byte {
+	line, _ := json.Marshal(jsonEntry{
+		Time:       entry.Time.UTC().Format(time.RFC3339Nano),
+		Method:     entry.Method,
+		URI:        entry.URI,
+		Proto:      entry.Proto,
+		Route:      entry.Route,
+		Status:     entry.Status,
+		Bytes:      entry.Bytes,
+		DurationMS: durationMS(entry.Duration),
+		IP:         entry.IP,
+		Referrer:   entry.Referrer,
+		UserAgent:  entry.UserAgent,
+		RequestID:  entry.RequestID,
+		UserID:     entry.UserID,
+	})
+	return append(buf, line...)
+}
+
+// formatCombined writes the combined log format understood by most log analyzers:
+// host ident user [time] "request" status bytes "referrer" "user agent"
+func formatCombined(buf []byte, entry Entry) []byte {
+	buf = append(buf, entry.IP...)
+	buf = append(buf, " - "...)
+	buf = append(buf, orDash(entry.UserID)...)
+	buf = append(buf, " ["...)
+	buf = entry.Time.AppendFormat(buf, "02/Jan/2006:15:04:05 -0700")
+	buf = append(buf, "] "...)
+	buf = strconv.AppendQuote(buf, entry.Method+" "+entry.URI+" "+entry.Proto)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(entry.Status), 10)
+	buf = append(buf, ' ')
+	if entry.Bytes > 0 {
+		buf = strconv.AppendInt(buf, entry.Bytes, 10)
+	} else {
+		buf = append(buf, '-')
+	}
+	buf = append(buf, ' ')
+	buf = strconv.AppendQuote(buf, orDash(entry.Referrer))
+	buf = append(buf, ' ')
+	buf = strconv.AppendQuote(buf, orDash(entry.UserAgent))
+	return buf
+}
+
+func formatLogfmt(buf []byte, entry Entry) []byte {
+	fields := []struct{ key, value string }{
+		{"time", entry.Time.UTC().Format(time.RFC3339Nano)},
+		{"method", entry.Method},
+		{"uri", entry.URI},
+		{"proto", entry.Proto},
+		{"route", entry.Route},
+		{"status", strconv.Itoa(entry.Status)},
+		{"bytes", strconv.FormatInt(entry.Bytes, 10)},
+		{"duration_ms", strconv.FormatFloat(durationMS(entry.Duration), 'f', -1, 64)},
+		{"ip", entry.IP},
+		{"referrer", entry.Referrer},
+		{"user_agent", entry.UserAgent},
+		{"request_id", entry.RequestID},
+		{"user_id", entry.UserID},
+	}
+	for i, field := range fields {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, field.key...)
+		buf = append(buf, '=')
+		buf = appendLogfmtValue(buf, field.value)
+	}
+	return buf
+}
+
+// appendLogfmtValue quotes values that would otherwise be ambiguous
+func appendLogfmtValue(buf []byte, value string) []byte {
+	if value == "" || strings.ContainsAny(value, " =\"\\") || strings.ContainsFunc(value, func(r rune) bool { return r < ' ' }) {
+		return strconv.AppendQuote(buf, value)
+	}
+	return append(buf, value...)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
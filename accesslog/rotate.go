@@ -0,0 +1,201 @@
+package accesslog
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat names the rotated files so that they sort chronologically
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotatingFile appends to a file, moving it aside to a timestamped backup when
+// it grows past its maximum size or age, and deletes the backups past retention
+type rotatingFile struct {
+	path        string
+	maxSize     int64
+	rotateEvery time.Duration
+	maxAge      time.Duration
+	maxBackups  int
+
+	file    *os.File
+	size    int64
+	started time.Time        // When the current file started receiving entries
+	now     func() time.Time // Replaced by tests
+}
+
+func openRotatingFile(cfg Config) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create access log directory: %w", err)
+	}
+
+	f := &rotatingFile{
+		path:        cfg.Path,
+		maxSize:     cfg.MaxSize,
+		rotateEvery: cfg.RotateEvery,
+		maxAge:      cfg.MaxAge,
+		maxBackups:  cfg.MaxBackups,
+		now:         time.Now,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	f.started = f.resumedAt()
+	return f, nil
+}
+
+// resumedAt returns when the file left by a previous process started: when the
+// latest backup was rotated, or its last write without backup. Counting from
+// the process start would never rotate services restarting more often.
+func (f *rotatingFile) resumedAt() time.Time {
+	if f.size == 0 {
+		return f.now()
+	}
+	if backups := f.backups(); len(backups) > 0 {
+		return backups[0].rotated
+	}
+	if info, err := f.file.Stat(); err == nil {
+		return info.ModTime()
+	}
+	return f.now()
+}
+
+// open opens the file for appending, its age counts from now
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.started = f.now()
+	return nil
+}
+
+// Write appends p to the file, rotating it first when due
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.due(len(p)) {
+		if err := f.rotate(); err != nil {
+			// Keep writing to the current file rather than losing entries
+			slog.Error("failed to rotate access log", "error", err)
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file must be rotated before writing n bytes
+func (f *rotatingFile) due(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+int64(n) > f.maxSize {
+		return true
+	}
+	return f.rotateEvery > 0 && f.now().Sub(f.started) >= f.rotateEvery
+}
+
+// rotate moves the current file to a backup and starts a new one
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close access log: %w", err)
+	}
+	if err := os.Rename(f.path, f.backupName(f.now())); err != nil {
+		// Reopen the current file so that writes keep working
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to move access log: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.prune()
+	return nil
+}
+
+// backupName returns the name of the backup rotated at t, e.g. access-2006-01-02T15-04-05.000.log
+func (f *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	return strings.TrimSuffix(f.path, ext) + "-" + t.Format(backupTimeFormat) + ext
+}
+
+// backup is a rotated file
+type backup struct {
+	path    string
+	rotated time.Time
+}
+
+// backups lists the backups of the file, most recent first. Only the names made
+// of the file name and a backupTimeFormat timestamp are backups, other files
+// sharing the prefix (e.g. access-errors.log) are left alone.
+func (f *rotatingFile) backups() []backup {
+	dir := filepath.Dir(f.path)
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(filepath.Base(f.path), ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Error("failed to list access log backups", "error", err)
+		return nil
+	}
+
+	var backups []backup
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if stamp, ok = strings.CutSuffix(stamp, ext); !ok || len(stamp) != len(backupTimeFormat) {
+			continue
+		}
+		rotated, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, entry.Name()), rotated: rotated})
+	}
+
+	slices.SortFunc(backups, func(a, b backup) int {
+		return b.rotated.Compare(a.rotated)
+	})
+	return backups
+}
+
+// prune deletes the backups older than the maximum age or beyond the maximum count
+func (f *rotatingFile) prune() {
+	if f.maxAge <= 0 && f.maxBackups <= 0 {
+		return
+	}
+
+	for i, backup := range f.backups() {
+		expired := f.maxBackups > 0 && i >= f.maxBackups
+		if f.maxAge > 0 && f.now().Sub(backup.rotated) > f.maxAge {
+			expired = true
+		}
+		if !expired {
+			continue
+		}
+		if err := os.Remove(backup.path); err != nil {
+			slog.Error("failed to delete access log backup", "error", err, "file", backup.path)
+		}
+	}
+}
+
+// Close closes the file
+func (f *rotatingFile) Close() error {
+	return f.file.Close()
+}
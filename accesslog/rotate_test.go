@@ -0,0 +1,180 @@
+package accesslog
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// listDir returns the names of the files in dir, sorted
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names
+}
+
+// backupFile creates a backup of access.log in dir rotated at rotated
+func backupFile(t *testing.T, dir string, rotated time.Time) string {
+	t.Helper()
+	name := "access-" + rotated.Format(backupTimeFormat) + ".log"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	f, err := openRotatingFile(Config{Path: filepath.Join(dir, "access.log"), MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"12345\n", "67890\n", "abc\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := listDir(t, dir)
+	if len(names) != 2 {
+		t.Fatalf("files = %v, want the log and a backup", names)
+	}
+	backup, _ := os.ReadFile(filepath.Join(dir, names[0]))
+	current, _ := os.ReadFile(filepath.Join(dir, "access.log"))
+	if string(backup) != "12345\n" || string(current) != "67890\nabc\n" {
+		t.Errorf("backup %q and log %q, want the first line moved aside", backup, current)
+	}
+}
+
+func TestRotatingFileRotatesByAge(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	f, err := openRotatingFile(Config{Path: filepath.Join(dir, "access.log"), RotateEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+	f.started = now
+
+	f.Write([]byte("first\n"))
+	now = now.Add(59 * time.Minute)
+	f.Write([]byte("second\n"))
+	if names := listDir(t, dir); len(names) != 1 {
+		t.Fatalf("files = %v, rotated before its age", names)
+	}
+
+	now = now.Add(time.Minute)
+	f.Write([]byte("third\n"))
+	if names := listDir(t, dir); len(names) != 2 {
+		t.Fatalf("files = %v, want a backup once an hour old", names)
+	}
+	if current, _ := os.ReadFile(filepath.Join(dir, "access.log")); string(current) != "third\n" {
+		t.Errorf("log = %q, want only the entry written after the rotation", current)
+	}
+}
+
+func TestRotatingFileAgeSurvivesRestarts(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, dir, path string)
+	}{
+		{
+			name: "latest backup",
+			prepare: func(t *testing.T, dir, path string) {
+				backupFile(t, dir, time.Now().Add(-3*time.Hour))
+				backupFile(t, dir, time.Now().Add(-2*time.Hour))
+			},
+		},
+		{
+			name: "last write without backup",
+			prepare: func(t *testing.T, dir, path string) {
+				old := time.Now().Add(-2 * time.Hour)
+				if err := os.Chtimes(path, old, old); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "access.log")
+			if err := os.WriteFile(path, []byte("before restart\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			tt.prepare(t, dir, path)
+			before := len(listDir(t, dir))
+
+			f, err := openRotatingFile(Config{Path: path, RotateEvery: time.Hour})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			f.Write([]byte("after restart\n"))
+
+			if after := len(listDir(t, dir)); after != before+1 {
+				t.Errorf("%d files after the first write, want %d: the file is older than an hour", after, before+1)
+			}
+		})
+	}
+}
+
+func TestRotatingFilePrune(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxAge     time.Duration
+		maxBackups int
+		kept       []int // Indexes of the backups kept, most recent first
+	}{
+		{name: "max backups", maxBackups: 2, kept: []int{0, 1}},
+		{name: "max age", maxAge: 90 * time.Minute, kept: []int{0}},
+		{name: "both", maxAge: 3*time.Hour + 30*time.Minute, maxBackups: 2, kept: []int{0, 1}},
+		{name: "none", kept: []int{0, 1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "access.log")
+			var backups []string
+			for i := range 4 {
+				backups = append(backups, backupFile(t, dir, time.Now().Add(-time.Duration(i+1)*time.Hour)))
+			}
+			// Files sharing the prefix aren't backups
+			for _, name := range []string{"access-errors.log", "access-2006.log", "other.log"} {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f, err := openRotatingFile(Config{Path: path, MaxAge: tt.maxAge, MaxBackups: tt.maxBackups})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			f.prune()
+
+			want := []string{"access-2006.log", "access-errors.log", "access.log", "other.log"}
+			for _, i := range tt.kept {
+				want = append(want, backups[i])
+			}
+			slices.Sort(want)
+			if got := listDir(t, dir); !slices.Equal(got, want) {
+				t.Errorf("files = %v, want %v", got, want)
+			}
+		})
+	}
+}
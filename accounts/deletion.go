@@ -0,0 +1,139 @@
+package accounts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/mail"
+)
+
+const (
+	// DeletionModePurge removes the user row and everything cascading from it
+	DeletionModePurge = "purge"
+	// DeletionModeAnonymize keeps the user row but strips personal data
+	DeletionModeAnonymize = "anonymize"
+)
+
+// DeletionConfig holds account deletion settings
+type DeletionConfig struct {
+	GracePeriod time.Duration `toml:"grace_period" yaml:"grace_period"` // Time during which signing in again restores the account
+	Mode        string        `toml:"mode" yaml:"mode"`                 // DeletionModePurge or DeletionModeAnonymize
+}
+
+// PurgeHook cleans up data stored outside the users table cascade
+// (files, external services) right before a user is purged
+type PurgeHook func(ctx context.Context, userID int64) error
+
+// DeletionService manages the account deletion lifecycle:
+// request, restore during the grace period and final purge
+type DeletionService struct {
+	users  repositories.UsersRepository
+	mailer mail.Mailer
+	config DeletionConfig
+	hooks  []PurgeHook
+}
+
+// NewDeletionService creates a deletion service
+func NewDeletionService(users repositories.UsersRepository, mailer mail.Mailer, cfg DeletionConfig) *DeletionService {
+	return &DeletionService{
+		users:  users,
+		mailer: mailer,
+		config: cfg,
+	}
+}
+
+// GracePeriod returns the configured grace period
+func (s *DeletionService) GracePeriod() time.Duration {
+	return s.config.GracePeriod
+}
+
+// OnPurge registers a hook run before each user is purged
+func (s *DeletionService) OnPurge(hook PurgeHook) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// RequestDeletion marks the account as pending deletion and revokes all its sessions
+func (s *DeletionService) RequestDeletion(ctx context.Context, user *models.User) error {
+	now := time.Now()
+	purgeAfter := now.Add(s.config.GracePeriod)
+	user.DeletedAt = &now
+	user.PurgeAfter = &purgeAfter
+
+	if err := s.users.UpdateUser(ctx, user); err != nil {
+		return fmt.Errorf("failed to mark user as deleted: %w", err)
+	}
+
+	if err := s.users.DeleteSessionsByUserID(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	err := s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your account is scheduled for deletion",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Your account will be permanently deleted on " + purgeAfter.Format("Mon 2 Jan 2006") + ".\n\n" +
+			"Changed your mind? Sign in again before that date to restore it.\n",
+	})
+	if err != nil {
+		logging.From(ctx).Error("failed to send deletion notification", "error", err, "user_id", user.ID)
+	}
+
+	return nil
+}
+
+// Restore cancels a pending deletion
+func (s *DeletionService) Restore(ctx context.Context, user *models.User) error {
+	if !user.IsPendingDeletion() {
+		return nil
+	}
+
+	user.DeletedAt = nil
+	user.PurgeAfter = nil
+	if err := s.users.UpdateUser(ctx, user); err != nil {
+		return fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	logging.From(ctx).Info("account deletion cancelled", "user_id", user.ID)
+	return nil
+}
+
+// PurgeDue purges every account whose grace period is over,
+// it is meant to run periodically from the scheduler
+func (s *DeletionService) PurgeDue(ctx context.Context) error {
+	users, err := s.users.ListUsersDueForPurge(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err := s.purge(ctx, user); err != nil {
+			logging.From(ctx).Error("failed to purge user", "error", err, "user_id", user.ID)
+			continue
+		}
+		logging.From(ctx).Info("user purged", "user_id", user.ID, "mode", s.config.Mode)
+	}
+
+	return nil
+}
+
+// purge runs the hooks then deletes or anonymizes the user
+func (s *DeletionService) purge(ctx context.Context, user *models.User) error {
+	for _, hook := range s.hooks {
+		if err := hook(ctx, user.ID); err != nil {
+			return fmt.Errorf("purge hook failed: %w", err)
+		}
+	}
+
+	if s.config.Mode != DeletionModeAnonymize {
+		return s.users.DeleteUser(ctx, user.ID)
+	}
+
+	if err := s.users.DeleteSessionsByUserID(ctx, user.ID); err != nil {
+		return err
+	}
+	return s.users.AnonymizeUser(ctx, user.ID)
+}
@@ -0,0 +1,85 @@
+package accounts
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/mail"
+)
+
+func init() {
+	// The log mailer and the purge write to the default logger
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestAnonymizedUserSignsInAgain(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+
+	users := repositories.NewUsersRepository(db.DB)
+	mailer, err := mail.New(mail.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deletion := NewDeletionService(users, mailer, DeletionConfig{Mode: DeletionModeAnonymize})
+
+	user := &models.User{GoogleID: "google-1", Email: "ada@example.com", ProviderEmail: "ada@example.com", Name: "Ada"}
+	if err := users.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := deletion.RequestDeletion(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := deletion.PurgeDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	anonymized, err := users.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anonymized.GoogleID == "google-1" || anonymized.Email == "ada@example.com" || anonymized.Name == "Ada" {
+		t.Errorf("personal data kept: %+v", anonymized)
+	}
+	if !anonymized.IsPurged() || anonymized.IsPendingDeletion() {
+		t.Errorf("purged = %v, pending deletion = %v, want a purged user", anonymized.IsPurged(), anonymized.IsPendingDeletion())
+	}
+
+	// Signing in with the same Google account looks the user up by Google ID,
+	// then signs up since there is no account anymore
+	found, err := users.GetUserByGoogleID(ctx, "google-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != nil {
+		t.Fatalf("sign in found user %d, want a new account", found.ID)
+	}
+	if found, err = users.GetUserByGoogleID(ctx, anonymized.GoogleID); err != nil || found != nil {
+		t.Errorf("placeholder Google ID found %v, %v, want no user", found, err)
+	}
+	again := &models.User{GoogleID: "google-1", Email: "ada@example.com", ProviderEmail: "ada@example.com", Name: "Ada"}
+	if err := users.CreateUser(ctx, again); err != nil {
+		t.Fatalf("failed to sign up again: %v", err)
+	}
+	if again.ID == user.ID {
+		t.Errorf("signed up into the anonymized account %d", user.ID)
+	}
+
+	// Later purges leave the anonymized row alone
+	if err := deletion.PurgeDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if purged, err := users.GetUserByID(ctx, user.ID); err != nil || *purged.PurgedAt != *anonymized.PurgedAt {
+		t.Errorf("anonymized user changed: %+v, %v", purged, err)
+	}
+}
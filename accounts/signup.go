@@ -0,0 +1,40 @@
+package accounts
+
+import "strings"
+
+// SignupPolicy restricts which email domains can create an account.
+// Existing accounts are not affected.
+type SignupPolicy struct {
+	AllowedDomains []string `toml:"allowed_domains" yaml:"allowed_domains"` // When not empty, only these domains can sign up
+	BlockedDomains []string `toml:"blocked_domains" yaml:"blocked_domains"` // These domains can never sign up
+}
+
+// Allows reports whether a new account can be created for the email.
+// Allow lists only trust emails verified by the identity provider.
+func (p SignupPolicy) Allows(email string, verified bool) bool {
+	_, domain, ok := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	if !ok || domain == "" {
+		return false
+	}
+
+	if matchesDomain(domain, p.BlockedDomains) {
+		return false
+	}
+
+	if len(p.AllowedDomains) > 0 {
+		return verified && matchesDomain(domain, p.AllowedDomains)
+	}
+
+	return true
+}
+
+// matchesDomain reports whether domain equals or is a subdomain of one of the domains
+func matchesDomain(domain string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "@"))
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
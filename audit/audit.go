@@ -0,0 +1,240 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/export"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/router"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionSignIn                 = "auth.sign_in"
+	ActionSignInFailed           = "auth.sign_in_failed"
+	ActionSignUp                 = "auth.sign_up"
+	ActionSignOut                = "auth.sign_out"
+	ActionProfileUpdated         = "user.profile_updated"
+	ActionEmailChangeRequested   = "user.email_change_requested"
+	ActionEmailChanged           = "user.email_changed"
+	ActionDataExportRequested    = "user.data_export_requested"
+	ActionAccountDeletionRequest = "user.deletion_requested"
+	ActionAccountRestored        = "user.deletion_cancelled"
+	ActionAccountPurged          = "user.purged"
+
+	ActionAdminSessionRevoked  = "admin.session_revoked"
+	ActionAdminSessionsRevoked = "admin.sessions_revoked"
+	ActionAdminUserDisabled    = "admin.user_disabled"
+	ActionAdminUserEnabled     = "admin.user_enabled"
+	ActionAdminUserDeleted     = "admin.user_deleted"
+
+	ActionImpersonationStarted = "admin.impersonation_started"
+	ActionImpersonationStopped = "admin.impersonation_stopped"
+)
+
+// TargetUser is the target type of events about a user account
+const TargetUser = "user"
+
+// reencryptBatchSize is the number of events re-encrypted per query by Reencrypt
+const reencryptBatchSize = 500
+
+// Entry describes an event to record
+type Entry struct {
+	ActorID    *int64         // Defaults to the authenticated user of the request
+	Action     string         // One of the Action* constants
+	TargetType string         // Kind of resource affected, e.g. TargetUser
+	TargetID   string         // Identifier of the resource affected
+	Metadata   map[string]any // Additional JSON details
+}
+
+// Config holds audit log settings
+type Config struct {
+	Retention time.Duration `toml:"retention" yaml:"retention"` // Events older than this are deleted, zero keeps them forever
+}
+
+// Logger records security-relevant events in the audit_events table
+type Logger struct {
+	events repositories.AuditEventsRepository
+	config Config
+}
+
+// New creates an audit logger
+func New(events repositories.AuditEventsRepository, cfg Config) *Logger {
+	return &Logger{
+		events: events,
+		config: cfg,
+	}
+}
+
+// Log records an event caused by an HTTP request, capturing the client IP,
+// user agent and request ID. Failures are logged, never returned, so that
+// auditing can't break the action being audited.
+func (l *Logger) Log(r *http.Request, entry Entry) {
+	if entry.ActorID == nil {
+		if user := auth.GetCurrentUser(r); user != nil {
+			entry.ActorID = &user.ID
+		}
+	}
+
+	// Actions performed while impersonating are attributed to the admin as well
+	if impersonator := auth.GetImpersonator(r); impersonator != nil {
+		metadata := map[string]any{"impersonator_id": impersonator.ID}
+		for key, value := range entry.Metadata {
+			metadata[key] = value
+		}
+		entry.Metadata = metadata
+	}
+
+	l.record(r.Context(), &models.AuditEvent{
+		ActorID:    entry.ActorID,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		IP:         router.ClientIP(r),
+		UserAgent:  r.UserAgent(),
+		RequestID:  r.Header.Get("X-Request-ID"),
+		Metadata:   entry.Metadata,
+	})
+}
+
+// LogSystem records an event performed by the application itself
+// (scheduled tasks, background jobs)
+func (l *Logger) LogSystem(ctx context.Context, entry Entry) {
+	l.record(ctx, &models.AuditEvent{
+		ActorID:    entry.ActorID,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		Metadata:   entry.Metadata,
+	})
+}
+
+// record stores the event and mirrors it to slog
+func (l *Logger) record(ctx context.Context, event *models.AuditEvent) {
+	if err := l.events.CreateAuditEvent(ctx, event); err != nil {
+		logging.From(ctx).Error("failed to record audit event", "error", err, "action", event.Action)
+		return
+	}
+
+	logging.From(ctx).Info("audit event",
+		"action", event.Action,
+		"actor_id", event.ActorID,
+		"target_type", event.TargetType,
+		"target_id", event.TargetID,
+		"request_id", event.RequestID,
+	)
+}
+
+// Query lists events matching the filter, newest first, with the total count
+// of matching events for pagination
+func (l *Logger) Query(ctx context.Context, filter repositories.AuditEventFilter) ([]*models.AuditEvent, int, error) {
+	events, err := l.events.ListAuditEvents(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := l.events.CountAuditEvents(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// ApplyRetention deletes events older than the retention period,
+// it is meant to run periodically from the scheduler
+func (l *Logger) ApplyRetention(ctx context.Context) error {
+	if l.config.Retention <= 0 {
+		return nil
+	}
+
+	deleted, err := l.events.DeleteAuditEventsBefore(ctx, time.Now().Add(-l.config.Retention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logging.From(ctx).Info("audit events deleted by retention policy", "count", deleted)
+	}
+
+	return nil
+}
+
+// Reencrypt encrypts with the primary key the IP and user agent of the events
+// protected by an older key (or none), so that the older key can be removed
+// from the ring. It is a scheduled task, a no-op once everything is re-encrypted.
+func (l *Logger) Reencrypt(ctx context.Context) error {
+	var updated, skipped int
+	var afterID int64
+	for {
+		progress, err := l.events.ReencryptAuditEvents(ctx, afterID, reencryptBatchSize)
+		if err != nil {
+			return err
+		}
+		updated += progress.Updated
+		skipped += progress.Skipped
+		if progress.Examined < reencryptBatchSize {
+			break
+		}
+		afterID = progress.LastID
+	}
+	if updated > 0 {
+		logging.From(ctx).Info("audit events re-encrypted with the primary key", "count", updated)
+	}
+	if skipped > 0 {
+		logging.From(ctx).Warn("audit events encrypted with a key missing from the ring were not re-encrypted", "count", skipped)
+	}
+	return nil
+}
+
+// UserPurged records the final purge of an account, used as a purge hook
+func (l *Logger) UserPurged(ctx context.Context, userID int64) error {
+	l.LogSystem(ctx, Entry{
+		Action:     ActionAccountPurged,
+		TargetType: TargetUser,
+		TargetID:   UserID(userID),
+	})
+	return nil
+}
+
+// Exporter returns the data export contributor for the events performed
+// by or about the user
+func (l *Logger) Exporter() export.Exporter {
+	return export.Func("audit_events", func(ctx context.Context, userID int64) (any, error) {
+		byUser, err := l.events.ListAuditEvents(ctx, repositories.AuditEventFilter{ActorID: userID})
+		if err != nil {
+			return nil, err
+		}
+
+		aboutUser, err := l.events.ListAuditEvents(ctx, repositories.AuditEventFilter{
+			TargetType: TargetUser,
+			TargetID:   UserID(userID),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Merge both lists without duplicating events the user performed on themselves
+		seen := make(map[int64]bool, len(byUser))
+		events := make([]*models.AuditEvent, 0, len(byUser)+len(aboutUser))
+		for _, event := range append(byUser, aboutUser...) {
+			if seen[event.ID] {
+				continue
+			}
+			seen[event.ID] = true
+			events = append(events, event)
+		}
+
+		return events, nil
+	})
+}
+
+// UserID formats a user ID as an audit target ID
+func UserID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"net/http"
+	"strconv"
 
 	"github.com/hyperstitieux/template/database/models"
 )
@@ -13,6 +14,8 @@ type contextKey string
 const (
 	// UserContextKey is the key used to store the user in the request context
 	UserContextKey contextKey = "user"
+	// ImpersonatorContextKey is the key used to store the impersonating admin in the request context
+	ImpersonatorContextKey contextKey = "impersonator"
 )
 
 // GetCurrentUser retrieves the authenticated user from the request context
@@ -24,12 +27,51 @@ func GetCurrentUser(r *http.Request) *models.User {
 	return user
 }
 
+// UserFromContext retrieves the authenticated user from a request context, for
+// handlers that only receive the context (typed JSON handlers, jobs)
+func UserFromContext(ctx context.Context) *models.User {
+	user, ok := ctx.Value(UserContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
 // SetCurrentUser stores the user in the request context
 func SetCurrentUser(r *http.Request, user *models.User) *http.Request {
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
 	return r.WithContext(ctx)
 }
 
+// GetImpersonator retrieves the admin impersonating the current user, nil when not impersonating
+func GetImpersonator(r *http.Request) *models.User {
+	user, ok := r.Context().Value(ImpersonatorContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// SetImpersonator stores the impersonating admin in the request context
+func SetImpersonator(r *http.Request, user *models.User) *http.Request {
+	ctx := context.WithValue(r.Context(), ImpersonatorContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// IsImpersonating checks if the current request is made by an admin impersonating the user
+func IsImpersonating(r *http.Request) bool {
+	return GetImpersonator(r) != nil
+}
+
+// RateLimitKey identifies authenticated users for rate limiting, empty for visitors
+func RateLimitKey(r *http.Request) string {
+	user := GetCurrentUser(r)
+	if user == nil {
+		return ""
+	}
+	return "user:" + strconv.FormatInt(user.ID, 10)
+}
+
 // IsAuthenticated checks if the current request has an authenticated user
 func IsAuthenticated(r *http.Request) bool {
 	return GetCurrentUser(r) != nil
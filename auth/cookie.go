@@ -5,6 +5,20 @@ import (
 	"time"
 )
 
+// secureCookies is whether cookies carry the Secure attribute, see SetSecureCookies
+var secureCookies = true
+
+// SetSecureCookies sets whether cookies are only sent over HTTPS. They are
+// unless the application is served over plain HTTP (e.g. http://localhost).
+func SetSecureCookies(secure bool) {
+	secureCookies = secure
+}
+
+// SecureCookies reports whether cookies are only sent over HTTPS
+func SecureCookies() bool {
+	return secureCookies
+}
+
 // CookieConfig holds configuration for secure cookie creation
 type CookieConfig struct {
 	Name     string
@@ -25,7 +39,7 @@ func DefaultCookieConfig(name, value string, duration time.Duration) CookieConfi
 		Value:    value,
 		Path:     "/",
 		Duration: duration,
-		Secure:   true,  // Always true in production
+		Secure:   secureCookies, // Unless served over plain HTTP
 		HttpOnly: true,  // Prevent XSS attacks
 		SameSite: http.SameSiteLaxMode, // CSRF protection
 	}
@@ -33,19 +47,6 @@ func DefaultCookieConfig(name, value string, duration time.Duration) CookieConfi
 
 // SetSecureCookie creates and sets a secure cookie on the response
 func SetSecureCookie(w http.ResponseWriter, r *http.Request, config CookieConfig) {
-	// Determine if we should use Secure flag based on environment
-	secure := config.Secure
-
-	// In development (no TLS), we may want to disable Secure flag
-	// but keep it enabled in production
-	// Check if running on localhost (with or without port)
-	host := r.Host
-	if r.TLS == nil && (host == "localhost" || host == "127.0.0.1" ||
-		len(host) > 10 && host[:10] == "localhost:" ||
-		len(host) > 10 && host[:10] == "127.0.0.1:") {
-		secure = false
-	}
-
 	maxAge := config.MaxAge
 	if maxAge == 0 && config.Duration > 0 {
 		maxAge = int(config.Duration.Seconds())
@@ -56,7 +57,7 @@ func SetSecureCookie(w http.ResponseWriter, r *http.Request, config CookieConfig
 		Value:    config.Value,
 		Path:     config.Path,
 		MaxAge:   maxAge,
-		Secure:   secure,
+		Secure:   config.Secure,
 		HttpOnly: config.HttpOnly,
 		SameSite: config.SameSite,
 		Domain:   config.Domain,
@@ -78,7 +79,7 @@ func ClearSessionCookie(w http.ResponseWriter, r *http.Request) {
 		Value:    "",
 		Path:     "/",
 		MaxAge:   -1,
-		Secure:   r.TLS != nil,
+		Secure:   secureCookies,
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
 	}
@@ -1,10 +1,14 @@
 package auth
 
 import (
-	"log/slog"
 	"net/http"
+	"strconv"
 
+	"github.com/hyperstitieux/template/database/models"
 	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
 )
 
 const (
@@ -12,14 +16,20 @@ const (
 	SessionCookieName = "session"
 )
 
-// AuthMiddleware creates a middleware that authenticates requests using session cookies
-func AuthMiddleware(users repositories.UsersRepository) func(http.Handler) http.Handler {
+// DisabledHandler responds to requests made with the session of a disabled user
+type DisabledHandler func(w http.ResponseWriter, r *http.Request, user *models.User)
+
+// AuthMiddleware creates a middleware that authenticates requests using session cookies.
+// Sessions of disabled users are revoked on first use and onDisabled explains why.
+func AuthMiddleware(users repositories.UsersRepository, onDisabled DisabledHandler) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger := logging.From(r.Context())
+
 			// Try to get session cookie
 			cookie, err := r.Cookie(SessionCookieName)
 			if err != nil {
-				slog.Debug("no session cookie found",
+				logger.Debug("no session cookie found",
 					"path", r.URL.Path,
 					"error", err,
 				)
@@ -28,15 +38,15 @@ func AuthMiddleware(users repositories.UsersRepository) func(http.Handler) http.
 				return
 			}
 
-			slog.Debug("session cookie found",
+			logger.Debug("session cookie found",
 				"path", r.URL.Path,
 				"cookie_name", SessionCookieName,
 			)
 
 			// Validate session and get user
-			user, err := users.GetUserBySessionToken(cookie.Value)
+			user, err := users.GetUserBySessionToken(r.Context(), cookie.Value)
 			if err != nil {
-				slog.Error("failed to get user by session token",
+				logger.Error("failed to get user by session token",
 					"error", err,
 					"path", r.URL.Path,
 				)
@@ -47,7 +57,7 @@ func AuthMiddleware(users repositories.UsersRepository) func(http.Handler) http.
 
 			// Session not found or expired
 			if user == nil {
-				slog.Debug("session not found or expired",
+				logger.Debug("session not found or expired",
 					"path", r.URL.Path,
 				)
 				// Continue without authentication
@@ -55,14 +65,55 @@ func AuthMiddleware(users repositories.UsersRepository) func(http.Handler) http.
 				return
 			}
 
-			slog.Debug("user authenticated",
+			// Disabled users lose their session immediately
+			if user.IsDisabled() {
+				logger.Info("blocked request from disabled user",
+					"path", r.URL.Path,
+					"user_id", user.ID,
+				)
+				if err := users.DeleteSession(r.Context(), cookie.Value); err != nil {
+					logger.Error("failed to revoke session of disabled user", "error", err, "user_id", user.ID)
+				}
+				ClearSessionCookie(w, r)
+				onDisabled(w, r, user)
+				return
+			}
+
+			// Impersonation sessions also carry the admin who started them
+			session, err := users.GetSessionByToken(r.Context(), cookie.Value)
+			if err != nil || session == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if session.ImpersonatorID != nil {
+				impersonator, err := users.GetUserByID(r.Context(), *session.ImpersonatorID)
+				if err != nil || impersonator == nil || !impersonator.IsAdmin() || impersonator.IsDisabled() {
+					logger.Warn("invalid impersonation session",
+						"path", r.URL.Path,
+						"user_id", user.ID,
+						"impersonator_id", *session.ImpersonatorID,
+					)
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				r = SetImpersonator(r, impersonator)
+			}
+
+			logger.Debug("user authenticated",
 				"path", r.URL.Path,
 				"user_id", user.ID,
 				"user_email", user.Email,
 			)
 
-			// Attach user to request context
+			// Attach user to request context, and to the logs of the request
 			r = SetCurrentUser(r, user)
+			logging.With(r.Context(), "user_id", user.ID)
+			router.SetAccessLogUser(r, strconv.FormatInt(user.ID, 10))
+			if session.ImpersonatorID != nil {
+				logging.With(r.Context(), "impersonator_id", *session.ImpersonatorID)
+			}
 
 			next.ServeHTTP(w, r)
 		})
@@ -84,6 +135,31 @@ func RequireAuthMiddleware(redirectURL string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireRoleMiddleware creates a middleware that only lets users with the given role through.
+// Anonymous users are redirected to sign in, other users get a 403 Forbidden.
+func RequireRoleMiddleware(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := GetCurrentUser(r)
+			if user == nil {
+				http.Redirect(w, r, routes.SignIn(r.URL.RequestURI()), http.StatusTemporaryRedirect)
+				return
+			}
+
+			if user.Role != role {
+				logging.From(r.Context()).Warn("access denied",
+					"path", r.URL.Path,
+					"required_role", role,
+				)
+				router.WriteError(w, r, router.ErrForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // RequireAuthHandler wraps a handler function that requires authentication
 func RequireAuthHandler(redirectURL string, handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
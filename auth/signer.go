@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/keyring"
+)
+
+var (
+	// ErrInvalidToken is returned when a signed token is malformed or tampered with
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned when a signed token is past its expiry
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// Claims is the payload carried by a signed token
+type Claims struct {
+	Purpose   string `json:"p"`           // What the token may be used for (e.g. "email-change")
+	Subject   string `json:"s"`           // Who the token is about, usually a user ID
+	Value     string `json:"v,omitempty"` // Optional value bound to the token
+	ExpiresAt int64  `json:"e"`           // Unix timestamp after which the token is rejected
+}
+
+// Signer creates and verifies HMAC-signed, self-contained tokens
+// used in links sent by email or short-lived download URLs
+type Signer struct {
+	primary string
+	keys    map[string][]byte // HMAC keys by key ID
+	legacy  []byte            // Key of the tokens signed before they named their key
+}
+
+// NewSigner creates a Signer signing with the primary key of ring. Tokens name
+// their key, so that those signed before a rotation stay valid until they expire.
+// Tokens signed before the key ring, without key ID, are verified with
+// legacySecret (the secret key), empty to reject them.
+func NewSigner(ring *keyring.Ring, legacySecret string) *Signer {
+	s := &Signer{primary: ring.Primary().ID, keys: make(map[string][]byte), legacy: []byte(legacySecret)}
+	for _, id := range ring.IDs() {
+		key, _ := ring.Lookup(id)
+		s.keys[id] = key.Derive("signer", sha256.Size)
+	}
+	return s
+}
+
+// Sign returns a URL-safe token for the given purpose, subject and value
+// that stays valid for ttl
+func (s *Signer) Sign(purpose, subject, value string, ttl time.Duration) (string, error) {
+	payload, err := json.Marshal(Claims{
+		Purpose:   purpose,
+		Subject:   subject,
+		Value:     value,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode claims: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	signed := encoded + "." + s.primary
+	return signed + "." + s.signature(s.keys[s.primary], signed), nil
+}
+
+// Verify checks the token signature, purpose and expiry and returns its claims
+func (s *Signer) Verify(purpose, token string) (*Claims, error) {
+	// payload.keyID.signature, or payload.signature before the key ring
+	var encoded string
+	switch parts := strings.Split(token, "."); len(parts) {
+	case 3:
+		var keyID, signature string
+		encoded, keyID, signature = parts[0], parts[1], parts[2]
+		key, ok := s.keys[keyID]
+		if !ok || !hmac.Equal([]byte(signature), []byte(s.signature(key, encoded+"."+keyID))) {
+			return nil, ErrInvalidToken
+		}
+	case 2:
+		encoded = parts[0]
+		if len(s.legacy) == 0 || !hmac.Equal([]byte(parts[1]), []byte(s.signature(s.legacy, encoded))) {
+			return nil, ErrInvalidToken
+		}
+	default:
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Purpose != purpose {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+// signature computes the base64 HMAC-SHA256 of the encoded payload and key ID
+func (s *Signer) signature(key []byte, signed string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperstitieux/template/keyring"
+)
+
+// legacyToken signs claims the way tokens were signed before they named their key
+func legacyToken(t *testing.T, secret string, claims Claims) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encoded))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSignerLegacyTokens(t *testing.T) {
+	valid := Claims{Purpose: "email-change", Subject: "1", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	expired := Claims{Purpose: "email-change", Subject: "1", ExpiresAt: time.Now().Add(-time.Hour).Unix()}
+
+	tests := []struct {
+		name   string
+		legacy string
+		token  string
+		err    error
+	}{
+		{name: "valid", legacy: "secret", token: legacyToken(t, "secret", valid)},
+		{name: "expired", legacy: "secret", token: legacyToken(t, "secret", expired), err: ErrExpiredToken},
+		{name: "other secret", legacy: "secret", token: legacyToken(t, "other", valid), err: ErrInvalidToken},
+		{name: "no legacy secret", token: legacyToken(t, "", valid), err: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := NewSigner(keyring.FromSecret("secret"), tt.legacy)
+			claims, err := signer.Verify("email-change", tt.token)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if err == nil && claims.Subject != "1" {
+				t.Errorf("subject = %q, want 1", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestSignerRotation(t *testing.T) {
+	old := keyring.FromSecret("old")
+	token, err := NewSigner(old, "").Sign("email-change", "1", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := keyring.Parse("new:" + base64.StdEncoding.EncodeToString(make([]byte, 32)) + ",default:" + base64.StdEncoding.EncodeToString(sha256Sum("old")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSigner(rotated, "").Verify("email-change", token); err != nil {
+		t.Errorf("token of the rotated-out primary key: %v", err)
+	}
+	if _, err := NewSigner(keyring.FromSecret("new"), "").Verify("email-change", token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token of a removed key: error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func sha256Sum(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
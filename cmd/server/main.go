@@ -1,16 +1,33 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/hyperstitieux/template/accesslog"
+	"github.com/hyperstitieux/template/accounts"
+	"github.com/hyperstitieux/template/audit"
 	"github.com/hyperstitieux/template/auth"
 	"github.com/hyperstitieux/template/config"
 	"github.com/hyperstitieux/template/controllers"
 	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
 	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/export"
+	"github.com/hyperstitieux/template/health"
+	"github.com/hyperstitieux/template/jobs"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/mail"
+	"github.com/hyperstitieux/template/metrics"
 	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
+	"github.com/hyperstitieux/template/server"
+	"github.com/hyperstitieux/template/tracing"
 	"github.com/hyperstitieux/template/views/pages"
 	"github.com/joho/godotenv"
 )
@@ -21,42 +38,152 @@ func main() {
 		slog.Warn("no .env file found or error loading it", "error", err)
 	}
 
-	cfg := config.New()
+	// Configuration: defaults, then the config file, the environment and the flags
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		slog.Error("invalid configuration\n" + err.Error())
+		os.Exit(2)
+	}
+
+	// Logger: requests and jobs get a child logger with their context, see logging.From
+	logger, err := logging.New(cfg.Logging, os.Stderr)
+	if err != nil {
+		slog.Error("failed to initialize logger", "error", err)
+		panic(err)
+	}
+	slog.SetDefault(logger)
+
+	// Access log: requests written in a standard format, to a rotated file when configured
+	var accessLog *accesslog.Logger
+	if cfg.AccessLog.Enabled() {
+		accessLog, err = accesslog.New(cfg.AccessLog)
+		if err != nil {
+			slog.Error("failed to open access log", "error", err)
+			panic(err)
+		}
+	}
+
+	// Tracing: spans of requests, queries and OAuth calls
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("failed to initialize tracing", "error", err)
+		panic(err)
+	}
 
 	// Initialize database
-	db, err := database.New(cfg.DatabaseURL)
+	db, err := database.New(cfg.Database.URL)
 	if err != nil {
 		slog.Error("failed to initialize database", "error", err)
 		panic(err)
 	}
-	defer db.Close()
+
+	// Key ring: the primary key encrypts and signs new data, older keys only
+	// decrypt and verify what they protected until it is re-encrypted or expires
+	ring, err := cfg.KeyRing()
+	if err != nil {
+		slog.Error("failed to load key ring", "error", err)
+		panic(err)
+	}
+	slog.Info("key ring loaded", "primary", ring.Primary().ID, "keys", ring.IDs())
+	columnRing := ring
+	if cfg.EphemeralKey() {
+		slog.Warn("sensitive columns are stored unencrypted, set SECRET_KEY or ENCRYPTION_KEYS to encrypt them")
+		columnRing = nil
+	}
 
 	// Initialize repositories
 	users := repositories.NewUsersRepository(db.DB)
+	dataExports := repositories.NewDataExportsRepository(db.DB)
+	auditEvents := repositories.NewAuditEventsRepository(db.DB, columnRing)
+
+	// Initialize services
+	mailer, err := mail.New(cfg.MailConfig())
+	if err != nil {
+		slog.Error("failed to initialize mailer", "error", err)
+		panic(err)
+	}
+	signer := auth.NewSigner(ring, cfg.Auth.SecretKey.Value())
+	queue := jobs.New(db.DB, jobs.DefaultConfig())
+	auditLogger := audit.New(auditEvents, cfg.Audit)
+
+	// Data export: register the exporters of every table holding user data
+	exportService := export.NewService(dataExports, users, queue, mailer, cfg.Exports.Dir, cfg.BaseURL)
+	exportService.Register(export.UserExporters(users)...)
+	exportService.Register(auditLogger.Exporter())
+	queue.Register(export.JobKind, exportService.Process)
+
+	// Account deletion: purge data stored outside the users cascade as well
+	deletionService := accounts.NewDeletionService(users, mailer, cfg.Accounts.Deletion)
+	deletionService.OnPurge(exportService.DeleteForUser)
+	deletionService.OnPurge(auditLogger.UserPurged)
+
+	// Periodic maintenance tasks
+	scheduler := jobs.NewScheduler()
+	scheduler.Every("purge-deleted-accounts", time.Hour, deletionService.PurgeDue)
+	scheduler.Every("delete-expired-data-exports", time.Hour, exportService.DeleteExpired)
+	scheduler.Every("audit-retention", 24*time.Hour, auditLogger.ApplyRetention)
+	scheduler.Every("audit-reencryption", time.Hour, auditLogger.Reencrypt)
+
+	// Start background job workers and scheduler
+	queue.Start()
+	scheduler.Start()
 
 	// Initialize controllers
-	googleOAuthController := controllers.NewGoogleOAuthController(users, cfg.GoogleOAuthConfig)
-	signOutController := controllers.NewSignOutController(users)
-	settingsController := controllers.NewSettingsController(users)
+	googleOAuthController := controllers.NewGoogleOAuthController(users, deletionService, auditLogger, cfg.GoogleOAuthConfig(), cfg.Auth.AdminEmails, cfg.Accounts.Signup)
+	settingsController := controllers.NewSettingsController(users, dataExports, deletionService, auditLogger, mailer, signer, cfg.BaseURL)
+	dataExportController := controllers.NewDataExportController(exportService, dataExports, auditLogger, signer)
+	adminController := controllers.NewAdminController(users, deletionService, auditLogger)
+	impersonationController := controllers.NewImpersonationController(users, auditLogger)
+	signOutController := controllers.NewSignOutController(users, auditLogger, impersonationController)
+	apiController := controllers.NewAPIController()
 
 	// Initialize router with default configuration
 	// Note: Hot reload endpoints are registered separately to bypass middleware
-	r, hotReloadMux := router.NewWithHotReload()
-
-	// Register hot reload endpoints (development only) on separate mux
-	// These bypass timeout/compression middleware to allow WebSocket connections
-	hotReloadMux.HandleFunc("/__hotreload", router.HotReloadHandler)
-	hotReloadMux.HandleFunc("/__hotreload_trigger", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			router.NotifyReload()
-			w.WriteHeader(http.StatusOK)
-		} else {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	})
+	routerConfig := cfg.RouterConfig()
+	routerConfig.AccessLog = accessLog
+	routerConfig.Timeouts = []router.TimeoutRule{
+		// Archives are streamed from disk and may take longer than a page to download
+		{Route: routes.DataExportDownload, Timeout: 0},
+	}
+	r, hotReloadMux := router.NewWithHotReload(routerConfig)
+	router.SetErrorRenderer(pages.Error)
+	auth.SetSecureCookies(cfg.SecureCookies())
+
+	// Developers see stack traces of server errors and build errors in the browser,
+	// and pages reload once rebuilt
+	var stopReloadWatcher server.Hook
+	if cfg.Debug {
+		router.SetDebugRenderer(pages.DevError)
+		router.SetHotReload(true)
+		stopReloadWatcher = router.StartReloadWatcher("tmp/build-errors.log")
+
+		// Register hot reload endpoints on a separate mux
+		// These bypass timeout/compression middleware to allow WebSocket connections
+		hotReloadMux.HandleFunc("/__hotreload", router.HotReloadHandler)
+		hotReloadMux.HandleFunc("/__hotreload_trigger", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "POST" {
+				router.NotifyReload()
+				w.WriteHeader(http.StatusOK)
+			} else {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		})
+	}
 
 	// Apply authentication middleware globally
-	r.Use(auth.AuthMiddleware(users))
+	r.Use(auth.AuthMiddleware(users, func(w http.ResponseWriter, r *http.Request, user *models.User) {
+		if err := pages.AccountDisabled(w, r, user); err != nil {
+			logging.From(r.Context()).Error("failed to render account disabled page", "error", err)
+		}
+	}))
+
+	// Limit each user (or client when signed out) separately, once the user is known
+	rateLimit := cfg.RateLimit()
+	rateLimit.Key = router.KeyFirst(auth.RateLimitKey, router.KeyByAPIToken, router.KeyByIP)
+	r.Use(router.RateLimit(rateLimit))
 
 	// Serve static files from public directory (without /public/ prefix)
 	fileServer := http.FileServer(http.Dir("./public"))
@@ -72,22 +199,106 @@ func main() {
 	})
 
 	// Register routes
-	r.Get("/", pages.Home)
-	r.Get("/settings", pages.Settings)
+	r.Get("/", pages.Home).Name("home")
+	r.Get("/settings", settingsController.Show).Name("settings")
 
 	// OAuth routes
-	r.Get("/auth/google", googleOAuthController.Redirect)
-	r.Get("/auth/google/callback", googleOAuthController.Callback)
-	r.Get("/auth/sign-out", signOutController.Handle)
+	r.Get("/auth/google", googleOAuthController.Redirect).Name("auth.google")
+	r.Get("/auth/google/callback", googleOAuthController.Callback).Name("auth.google.callback")
+	r.Get("/auth/sign-out", signOutController.Handle).Name("auth.sign_out")
+	r.Post("/auth/impersonation/stop", impersonationController.Stop).Name("auth.impersonation.stop")
 
 	// Settings routes
-	r.Post("/settings/update-profile", settingsController.UpdateProfile)
-	r.Post("/settings/delete-account", settingsController.DeleteAccount)
+	r.Post("/settings/update-profile", settingsController.UpdateProfile).Name("settings.update_profile")
+	r.Post("/settings/change-email", settingsController.ChangeEmail).Name("settings.change_email")
+	r.Get("/settings/verify-email", settingsController.VerifyEmail).Name("settings.verify_email")
+	r.Post("/settings/delete-account", settingsController.DeleteAccount).Name("settings.delete_account")
+	r.Post("/settings/export", dataExportController.Request).Name("settings.export")
+	r.Get("/settings/export/download", dataExportController.Download).Name("settings.export.download")
+
+	// JSON API routes
+	r.Route("/api", func(api *router.Router) {
+		router.HandleJSON(api, http.MethodGet, "/me", "Profile of the signed in user", apiController.Me).Name("api.me")
+	})
+
+	// Admin routes, restricted to users with the admin role
+	r.Route("/admin", func(admin *router.Router) {
+		admin.Use(auth.RequireRoleMiddleware(models.RoleAdmin))
+		admin.Get("", adminController.Users).Name("admin.users")
+		admin.Get("/users/{id:[0-9]+}", adminController.User).Name("admin.user")
+		admin.Post("/users/{id:[0-9]+}/sessions/revoke", adminController.RevokeSessions).Name("admin.user.sessions.revoke")
+		admin.Post("/users/{id:[0-9]+}/sessions/{sessionID:[0-9]+}/revoke", adminController.RevokeSession).Name("admin.user.session.revoke")
+		admin.Post("/users/{id:[0-9]+}/disable", adminController.Disable).Name("admin.user.disable")
+		admin.Post("/users/{id:[0-9]+}/enable", adminController.Enable).Name("admin.user.enable")
+		admin.Post("/users/{id:[0-9]+}/delete", adminController.Delete).Name("admin.user.delete")
+		admin.Post("/users/{id:[0-9]+}/impersonate", impersonationController.Start).Name("admin.user.impersonate")
+	})
+
+	// OpenAPI document of the JSON API, built from the typed routes registered above
+	apiDoc, err := r.OpenAPI(router.OpenAPIInfo{Title: "French Software API", Version: "1.0.0"})
+	if err != nil {
+		slog.Error("failed to build openapi document", "error", err)
+		os.Exit(1)
+	}
+	r.Get("/openapi.json", router.OpenAPIHandler(apiDoc)).Name("openapi")
+	if cfg.APIDocs {
+		r.Get("/docs/api", func(w http.ResponseWriter, r *http.Request) error {
+			return pages.APIDocs(w, r, apiDoc)
+		})
+	}
+
+	// Fail fast when a view or controller links to a route that doesn't exist
+	if err := r.CheckRoutes(); err != nil {
+		slog.Error("invalid routes", "error", err)
+		os.Exit(1)
+	}
+
+	// Readiness checks of the dependencies needed to serve requests
+	checker := health.New()
+	checker.Add("database", db.Ping)
+	checker.Add("migrations", health.Migrations(db.PendingMigrations))
+	checker.Add("jobs", health.JobBacklog(queue.Backlog, cfg.Jobs.MaxBacklog))
+
+	// Probes bypass the router middleware so they are never rate limited or logged
+	root := http.NewServeMux()
+	root.Handle("GET /healthz", health.Liveness())
+	root.Handle("GET /readyz", checker)
+	root.Handle("/", r)
+
+	// Serve until SIGINT/SIGTERM, then release resources in dependency order
+	srv := server.New(cfg.Server, root)
+	srv.OnDrain(checker.Drain)
+
+	// Metrics get their own listener when possible so they're never public
+	if metricsConfig := cfg.MetricsConfig(); metricsConfig.Enabled() {
+		metrics.RegisterDB(db.DB, "main")
+		if metricsConfig.Addr != "" {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("GET /metrics", metrics.Handler(metricsConfig.Token))
+			srv.Listen(metricsConfig.Addr, metricsMux)
+		} else {
+			root.Handle("GET /metrics", metrics.Handler(metricsConfig.Token))
+		}
+	}
+	srv.OnShutdown("hot reload clients", router.CloseHotReloadClients)
+	if stopReloadWatcher != nil {
+		srv.OnShutdown("hot reload watcher", stopReloadWatcher)
+	}
+	if accessLog != nil {
+		srv.OnShutdown("access log", func(ctx context.Context) error {
+			return accessLog.Close()
+		})
+	}
+	srv.OnShutdown("scheduler", scheduler.Stop)
+	srv.OnShutdown("job workers", queue.Stop)
+	srv.OnShutdown("database", func(ctx context.Context) error {
+		return db.Close()
+	})
+	// Last, so that the spans of the other hooks are exported
+	srv.OnShutdown("tracing", shutdownTracing)
 
-	// Start HTTP server
-	slog.Info("http server listening", "addr", cfg.HTTPAddr)
-	if err := http.ListenAndServe(cfg.HTTPAddr, r); err != nil {
-		slog.Error("failed to start http server", "error", err)
+	if err := srv.Run(context.Background()); err != nil {
+		slog.Error("server stopped with errors", "error", err)
 		os.Exit(1)
 	}
 }
@@ -1,36 +1,265 @@
 package config
 
 import (
-	"github.com/hyperstitieux/template/env"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hyperstitieux/template/accesslog"
+	"github.com/hyperstitieux/template/accounts"
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/keyring"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/mail"
+	"github.com/hyperstitieux/template/metrics"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/server"
+	"github.com/hyperstitieux/template/tracing"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
-type config struct {
-	HTTPAddr         string
-	DatabaseURL      string
-	GoogleOAuthConfig *oauth2.Config
-	BaseURL          string
-}
-
-type Config *config
-
-func New() Config {
-	baseURL := env.GetVar("BASE_URL", "http://localhost:8080")
-
-	return &config{
-		HTTPAddr:    env.GetVar("HTTP_ADDR", ":8080"),
-		DatabaseURL: env.GetVar("DATABASE_URL", "file:app.db"),
-		BaseURL:     baseURL,
-		GoogleOAuthConfig: &oauth2.Config{
-			ClientID:     env.GetVar("GOOGLE_CLIENT_ID", ""),
-			ClientSecret: env.GetVar("GOOGLE_CLIENT_SECRET", ""),
-			RedirectURL:  baseURL + "/auth/google/callback",
-			Scopes: []string{
-				"https://www.googleapis.com/auth/userinfo.email",
-				"https://www.googleapis.com/auth/userinfo.profile",
-			},
-			Endpoint: google.Endpoint,
+// Config holds the settings of the application, see Load for where they come from
+type Config struct {
+	BaseURL   string           `toml:"base_url" yaml:"base_url"`
+	APIDocs   bool             `toml:"api_docs" yaml:"api_docs"`
+	Debug     bool             `toml:"debug" yaml:"debug"` // Development error page and build error overlay, never in production
+	Server    server.Config    `toml:"server" yaml:"server"`
+	Database  Database         `toml:"database" yaml:"database"`
+	Router    Router           `toml:"router" yaml:"router"`
+	Auth      Auth             `toml:"auth" yaml:"auth"`
+	Mail      Mail             `toml:"mail" yaml:"mail"`
+	Logging   logging.Config   `toml:"logging" yaml:"logging"`
+	AccessLog accesslog.Config `toml:"access_log" yaml:"access_log"`
+	Metrics   Metrics          `toml:"metrics" yaml:"metrics"`
+	Tracing   tracing.Config   `toml:"tracing" yaml:"tracing"`
+	Accounts  Accounts         `toml:"accounts" yaml:"accounts"`
+	Audit     audit.Config     `toml:"audit" yaml:"audit"`
+	Jobs      Jobs             `toml:"jobs" yaml:"jobs"`
+	Exports   Exports          `toml:"exports" yaml:"exports"`
+
+	ephemeralKey bool // The secret key was generated for this process
+}
+
+// Database holds the connection settings of the database
+type Database struct {
+	URL string `toml:"url" yaml:"url"`
+}
+
+// Router holds the settings of the request middleware
+type Router struct {
+	AllowedOrigins     []string       `toml:"allowed_origins" yaml:"allowed_origins"` // CORS is disabled when empty
+	Compression        bool           `toml:"compression" yaml:"compression"`
+	RequestTimeout     time.Duration  `toml:"request_timeout" yaml:"request_timeout"`
+	LogRequests        bool           `toml:"log_requests" yaml:"log_requests"`
+	TrustedProxies     []netip.Prefix `toml:"trusted_proxies" yaml:"trusted_proxies"`
+	HSTSMaxAge         time.Duration  `toml:"hsts_max_age" yaml:"hsts_max_age"`
+	GlobalRateLimit    int            `toml:"global_rate_limit" yaml:"global_rate_limit"` // Requests per second shared by all clients, an opt-in overload guard
+	GlobalRateBurst    int            `toml:"global_rate_burst" yaml:"global_rate_burst"`
+	RateLimitPerMinute int            `toml:"rate_limit_per_minute" yaml:"rate_limit_per_minute"` // Requests of each client, 0 disables it
+	AuthRateLimit      int            `toml:"auth_rate_limit_per_minute" yaml:"auth_rate_limit_per_minute"`
+}
+
+// Auth holds the secrets and sign in settings
+type Auth struct {
+	SecretKey          Secret   `toml:"secret_key" yaml:"secret_key"`           // Signs links, random for the process when empty
+	EncryptionKeys     Secret   `toml:"encryption_keys" yaml:"encryption_keys"` // Key ring replacing the secret key, see KeyRing
+	GoogleClientID     string   `toml:"google_client_id" yaml:"google_client_id"`
+	GoogleClientSecret Secret   `toml:"google_client_secret" yaml:"google_client_secret"`
+	AdminEmails        []string `toml:"admin_emails" yaml:"admin_emails"`
+}
+
+// Mail holds the SMTP settings, emails are only logged without a host
+type Mail struct {
+	Host     string `toml:"host" yaml:"host"`
+	Port     string `toml:"port" yaml:"port"`
+	Username string `toml:"username" yaml:"username"`
+	Password Secret `toml:"password" yaml:"password"`
+	From     string `toml:"from" yaml:"from"`
+}
+
+// Metrics holds where Prometheus metrics are served
+type Metrics struct {
+	Addr  string `toml:"addr" yaml:"addr"`
+	Token Secret `toml:"token" yaml:"token"`
+}
+
+// Accounts holds the sign up and deletion policies
+type Accounts struct {
+	Signup   accounts.SignupPolicy   `toml:"signup" yaml:"signup"`
+	Deletion accounts.DeletionConfig `toml:"deletion" yaml:"deletion"`
+}
+
+// Jobs holds the settings of the background jobs
+type Jobs struct {
+	MaxBacklog int `toml:"max_backlog" yaml:"max_backlog"` // Pending jobs above which the application isn't ready
+}
+
+// Exports holds the settings of the data exports
+type Exports struct {
+	Dir string `toml:"dir" yaml:"dir"`
+}
+
+// Default returns the configuration used when nothing overrides it
+func Default() Config {
+	routerDefaults := router.DefaultConfig()
+	return Config{
+		BaseURL:  "http://localhost:8080",
+		Server:   server.DefaultConfig(),
+		Database: Database{URL: "file:app.db"},
+		Router: Router{
+			Compression:        routerDefaults.EnableCompression,
+			RequestTimeout:     routerDefaults.RequestTimeout,
+			LogRequests:        routerDefaults.LogRequests,
+			HSTSMaxAge:         routerDefaults.HSTSMaxAge,
+			GlobalRateLimit:    routerDefaults.RateLimitRPS,
+			GlobalRateBurst:    routerDefaults.RateLimitBurst,
+			RateLimitPerMinute: 300,
+			AuthRateLimit:      20,
+		},
+		Mail: Mail{
+			Port: "587",
+			From: "French Software <no-reply@localhost>",
+		},
+		Logging: logging.Config{Level: "info", Format: logging.FormatText},
+		AccessLog: accesslog.Config{
+			Format:      accesslog.FormatJSON,
+			MaxSize:     100 << 20,
+			RotateEvery: 24 * time.Hour,
+			MaxAge:      30 * 24 * time.Hour,
+		},
+		Tracing: tracing.Config{ServiceName: "template"},
+		Accounts: Accounts{
+			Deletion: accounts.DeletionConfig{GracePeriod: 14 * 24 * time.Hour, Mode: accounts.DeletionModePurge},
+		},
+		Audit:   audit.Config{Retention: 365 * 24 * time.Hour},
+		Jobs:    Jobs{MaxBacklog: 100},
+		Exports: Exports{Dir: "data/exports"},
+	}
+}
+
+// RouterConfig returns the middleware configuration of the router
+func (c Config) RouterConfig() router.Config {
+	cfg := router.DefaultConfig()
+	cfg.EnableCORS = len(c.Router.AllowedOrigins) > 0
+	cfg.AllowedOrigins = c.Router.AllowedOrigins
+	cfg.EnableCompression = c.Router.Compression
+	cfg.EnableRateLimit = c.Router.GlobalRateLimit > 0
+	cfg.RateLimitRPS = c.Router.GlobalRateLimit
+	cfg.RateLimitBurst = c.Router.GlobalRateBurst
+	cfg.RequestTimeout = c.Router.RequestTimeout
+	cfg.LogRequests = c.Router.LogRequests
+	cfg.TrustedProxies = c.Router.TrustedProxies
+	cfg.HSTSMaxAge = c.Router.HSTSMaxAge
+	cfg.EnableMetrics = c.MetricsConfig().Enabled()
+	cfg.EnableTracing = c.Tracing.Enabled()
+	return cfg
+}
+
+// RateLimit returns the limits applied to each client
+func (c Config) RateLimit() router.RateLimitConfig {
+	return router.RateLimitConfig{
+		Name:  "client",
+		Limit: router.Limit{Requests: c.Router.RateLimitPerMinute, Period: time.Minute},
+		Rules: []router.RateLimitRule{
+			// Sign in attempts are expensive and a target for abuse
+			{PathPrefix: "/auth/", Limit: router.Limit{Requests: c.Router.AuthRateLimit, Period: time.Minute}},
+		},
+	}
+}
+
+// GoogleOAuthConfig returns the OAuth client signing users in with Google
+func (c Config) GoogleOAuthConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.Auth.GoogleClientID,
+		ClientSecret: c.Auth.GoogleClientSecret.Value(),
+		RedirectURL:  c.BaseURL + "/auth/google/callback",
+		Scopes: []string{
+			"https://www.googleapis.com/auth/userinfo.email",
+			"https://www.googleapis.com/auth/userinfo.profile",
 		},
+		Endpoint: google.Endpoint,
+	}
+}
+
+// MailConfig returns the settings of the mailer
+func (c Config) MailConfig() mail.Config {
+	return mail.Config{
+		Host:     c.Mail.Host,
+		Port:     c.Mail.Port,
+		Username: c.Mail.Username,
+		Password: c.Mail.Password.Value(),
+		From:     c.Mail.From,
+	}
+}
+
+// KeyRing returns the keys encrypting sensitive columns and signing links:
+// the encryption keys, primary key first, or a single key derived from the
+// secret key when they are not set
+func (c Config) KeyRing() (*keyring.Ring, error) {
+	if c.Auth.EncryptionKeys == "" {
+		return keyring.FromSecret(c.Auth.SecretKey.Value()), nil
+	}
+	ring, err := keyring.Parse(c.Auth.EncryptionKeys.Value())
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption keys: %w", err)
+	}
+	return ring, nil
+}
+
+// EphemeralKey reports whether the key ring only lives as long as the process,
+// data stored encrypted with it couldn't be read after a restart
+func (c Config) EphemeralKey() bool {
+	return c.ephemeralKey
+}
+
+// SecureCookies reports whether cookies are only sent over HTTPS, which is
+// the case unless the base URL is plain HTTP
+func (c Config) SecureCookies() bool {
+	return !strings.HasPrefix(c.BaseURL, "http://")
+}
+
+// MetricsConfig returns where metrics are served
+func (c Config) MetricsConfig() metrics.Config {
+	return metrics.Config{Addr: c.Metrics.Addr, Token: c.Metrics.Token.Value()}
+}
+
+// String returns the configuration as TOML, secrets redacted
+func (c Config) String() string {
+	var b strings.Builder
+	if err := toml.NewEncoder(&b).Encode(c); err != nil {
+		return fmt.Sprintf("invalid configuration: %v", err)
 	}
+	return b.String()
+}
+
+// Secret is a configuration value that is never printed nor logged
+type Secret string
+
+const redacted = "[redacted]"
+
+// Value returns the secret itself
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String redacts the secret, it is empty when not set
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// MarshalText redacts the secret when the configuration is encoded
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText reads the secret from a configuration file
+func (s *Secret) UnmarshalText(text []byte) error {
+	*s = Secret(text)
+	return nil
 }
@@ -0,0 +1,376 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hyperstitieux/template/accesslog"
+	"github.com/hyperstitieux/template/router"
+	"go.yaml.in/yaml/v3"
+)
+
+// Load builds the configuration from, by increasing precedence: the defaults,
+// the TOML or YAML file given by -config or CONFIG_FILE, the environment
+// variables and the command line flags. It fails with every invalid value at once.
+// Secrets may also be read from the file named by their variable suffixed with
+// _FILE (e.g. SECRET_KEY_FILE), as mounted by Docker and Kubernetes secrets.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+	settings := bindings(&cfg)
+
+	// Flags are applied last but parsed first, they may name the file
+	flags, err := parseFlags(settings, args)
+	if err != nil {
+		return cfg, err
+	}
+
+	path := os.Getenv("CONFIG_FILE")
+	if file, ok := flags["config"]; ok {
+		path = file
+	}
+	if path != "" {
+		if err := readFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	var errs []error
+	for _, s := range settings {
+		value, ok, err := s.lookupEnv()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			if err := s.value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+	for _, s := range settings {
+		if value, ok := flags[s.flag()]; ok {
+			if err := s.value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", s.flag(), err))
+			}
+		}
+	}
+	if cfg.Auth.SecretKey == "" && cfg.Auth.EncryptionKeys == "" {
+		cfg.Auth.SecretKey = randomSecret()
+		cfg.ephemeralKey = true
+	}
+	// Report the invalid values along with the unparsable ones
+	return cfg, errors.Join(append(errs, cfg.Validate())...)
+}
+
+// readFile decodes a TOML or YAML file, depending on its extension, over cfg.
+// Unknown keys are rejected so that typos don't go unnoticed.
+func readFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return fmt.Errorf("unknown keys in config file %s: %s", path, strings.Join(keys, ", "))
+		}
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file %s, expected .toml, .yaml or .yml", path)
+	}
+	return nil
+}
+
+// parseFlags returns the value of the flags set in args, by name
+func parseFlags(settings []setting, args []string) (map[string]string, error) {
+	values := make(map[string]string)
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.Var(rawFlag{name: "config", values: values}, "config", "TOML or YAML configuration file (CONFIG_FILE)")
+	for _, s := range settings {
+		// Secrets would be visible to anyone listing the processes
+		if s.secret {
+			continue
+		}
+		_, isBool := s.value.(*boolValue)
+		fs.Var(rawFlag{name: s.flag(), values: values, isBool: isBool}, s.flag(), s.usage+" ("+s.env+")")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// rawFlag records the value of a flag, applied once the file and environment are loaded
+type rawFlag struct {
+	name   string
+	values map[string]string
+	isBool bool
+}
+
+func (f rawFlag) String() string {
+	return ""
+}
+
+func (f rawFlag) Set(value string) error {
+	f.values[f.name] = value
+	return nil
+}
+
+func (f rawFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// setting binds an environment variable and a flag to a field of the configuration
+type setting struct {
+	env    string
+	usage  string
+	value  value
+	secret bool // Never read from flags
+}
+
+// flag returns the flag name of the setting, e.g. -http-addr for HTTP_ADDR
+func (s setting) flag() string {
+	return strings.ToLower(strings.ReplaceAll(s.env, "_", "-"))
+}
+
+// lookupEnv returns the value of the setting's environment variable or, for
+// secrets, the content of the file named by the variable suffixed with _FILE
+func (s setting) lookupEnv() (string, bool, error) {
+	value, ok := os.LookupEnv(s.env)
+	if !s.secret {
+		return value, ok, nil
+	}
+
+	path, fromFile := os.LookupEnv(s.env + "_FILE")
+	if !fromFile {
+		return value, ok, nil
+	}
+	if ok {
+		return "", false, fmt.Errorf("%s and %s_FILE are both set", s.env, s.env)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: failed to read secret: %w", s.env, err)
+	}
+	// Editors and echo end files with a newline that isn't part of the secret
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// bindings lists the environment variables and flags overriding the configuration
+func bindings(c *Config) []setting {
+	return []setting{
+		{env: "BASE_URL", usage: "Public URL of the application", value: (*stringValue)(&c.BaseURL)},
+		{env: "API_DOCS", usage: "Serve the API documentation at /docs/api", value: (*boolValue)(&c.APIDocs)},
+		{env: "DEBUG", usage: "Show stack traces, source and headers of server errors in the browser", value: (*boolValue)(&c.Debug)},
+
+		{env: "HTTP_ADDR", usage: "Address the server listens on", value: (*stringValue)(&c.Server.Addr)},
+		{env: "HTTP_READ_HEADER_TIMEOUT", usage: "Time allowed to read the request headers", value: (*durationValue)(&c.Server.ReadHeaderTimeout)},
+		{env: "HTTP_READ_TIMEOUT", usage: "Time allowed to read the whole request", value: (*durationValue)(&c.Server.ReadTimeout)},
+		{env: "HTTP_WRITE_TIMEOUT", usage: "Time allowed to write the response", value: (*durationValue)(&c.Server.WriteTimeout)},
+		{env: "HTTP_IDLE_TIMEOUT", usage: "How long keep-alive connections wait for the next request", value: (*durationValue)(&c.Server.IdleTimeout)},
+		{env: "SHUTDOWN_TIMEOUT", usage: "Time given to in-flight work on shutdown", value: (*durationValue)(&c.Server.ShutdownTimeout)},
+		{env: "SHUTDOWN_DRAIN_DELAY", usage: "Time /readyz reports not ready before the listeners close", value: (*durationValue)(&c.Server.DrainDelay)},
+		{env: "TLS_CERT_FILE", usage: "TLS certificate, HTTPS is served with the key", value: (*stringValue)(&c.Server.TLSCertFile)},
+		{env: "TLS_KEY_FILE", usage: "TLS private key", value: (*stringValue)(&c.Server.TLSKeyFile)},
+		{env: "HTTP_REDIRECT_ADDR", usage: "Address of a listener redirecting HTTP to HTTPS", value: (*stringValue)(&c.Server.RedirectAddr)},
+
+		{env: "DATABASE_URL", usage: "SQLite database URL", value: (*stringValue)(&c.Database.URL)},
+
+		{env: "CORS_ALLOWED_ORIGINS", usage: "Comma separated origins allowed by CORS", value: (*listValue)(&c.Router.AllowedOrigins)},
+		{env: "COMPRESSION", usage: "Compress responses with gzip", value: (*boolValue)(&c.Router.Compression)},
+		{env: "REQUEST_TIMEOUT", usage: "Time allowed to handle a request", value: (*durationValue)(&c.Router.RequestTimeout)},
+		{env: "LOG_REQUESTS", usage: "Log every request", value: (*boolValue)(&c.Router.LogRequests)},
+		{env: "TRUSTED_PROXIES", usage: "Comma separated proxies allowed to set forwarding headers", value: (*proxiesValue)(&c.Router.TrustedProxies)},
+		{env: "HSTS_MAX_AGE_DAYS", usage: "Strict-Transport-Security max-age in days", value: (*daysValue)(&c.Router.HSTSMaxAge)},
+		{env: "GLOBAL_RATE_LIMIT_RPS", usage: "Requests per second of all clients together", value: (*intValue)(&c.Router.GlobalRateLimit)},
+		{env: "GLOBAL_RATE_LIMIT_BURST", usage: "Burst of the global rate limit", value: (*intValue)(&c.Router.GlobalRateBurst)},
+		{env: "RATE_LIMIT_PER_MINUTE", usage: "Requests per minute of each client", value: (*intValue)(&c.Router.RateLimitPerMinute)},
+		{env: "AUTH_RATE_LIMIT_PER_MINUTE", usage: "Sign in requests per minute of each client", value: (*intValue)(&c.Router.AuthRateLimit)},
+
+		{env: "SECRET_KEY", usage: "Key signing links", value: (*stringValue)(&c.Auth.SecretKey), secret: true},
+		{env: "ENCRYPTION_KEYS", usage: "Comma separated id:base64 keys encrypting and signing data, primary key first", value: (*stringValue)(&c.Auth.EncryptionKeys), secret: true},
+		{env: "GOOGLE_CLIENT_ID", usage: "Google OAuth client ID", value: (*stringValue)(&c.Auth.GoogleClientID)},
+		{env: "GOOGLE_CLIENT_SECRET", usage: "Google OAuth client secret", value: (*stringValue)(&c.Auth.GoogleClientSecret), secret: true},
+		{env: "ADMIN_EMAILS", usage: "Comma separated emails of the administrators", value: (*listValue)(&c.Auth.AdminEmails)},
+
+		{env: "SMTP_HOST", usage: "SMTP server, emails are logged when empty", value: (*stringValue)(&c.Mail.Host)},
+		{env: "SMTP_PORT", usage: "SMTP port", value: (*stringValue)(&c.Mail.Port)},
+		{env: "SMTP_USERNAME", usage: "SMTP username", value: (*stringValue)(&c.Mail.Username)},
+		{env: "SMTP_PASSWORD", usage: "SMTP password", value: (*stringValue)(&c.Mail.Password), secret: true},
+		{env: "MAIL_FROM", usage: "Sender of the emails", value: (*stringValue)(&c.Mail.From)},
+
+		{env: "LOG_LEVEL", usage: "Minimum level of the logs: debug, info, warn or error", value: (*stringValue)(&c.Logging.Level)},
+		{env: "LOG_FORMAT", usage: "Format of the logs: text or json", value: (*stringValue)(&c.Logging.Format)},
+
+		{env: "ACCESS_LOG_FILE", usage: "Access log file, - for the standard output", value: (*stringValue)(&c.AccessLog.Path)},
+		{env: "ACCESS_LOG_FORMAT", usage: "Access log format: json, combined or logfmt", value: (*stringValue)(&c.AccessLog.Format)},
+		{env: "ACCESS_LOG_MAX_SIZE_MB", usage: "Size above which the access log is rotated", value: (*megabytesValue)(&c.AccessLog.MaxSize)},
+		{env: "ACCESS_LOG_ROTATE_EVERY", usage: "Age above which the access log is rotated", value: (*durationValue)(&c.AccessLog.RotateEvery)},
+		{env: "ACCESS_LOG_MAX_AGE_DAYS", usage: "Rotated access logs older than this are deleted", value: (*daysValue)(&c.AccessLog.MaxAge)},
+		{env: "ACCESS_LOG_MAX_BACKUPS", usage: "Number of rotated access logs kept", value: (*intValue)(&c.AccessLog.MaxBackups)},
+		{env: "ACCESS_LOG_EXCLUDE", usage: "Comma separated path prefixes never logged", value: (*listValue)(&c.AccessLog.Exclude)},
+		{env: "ACCESS_LOG_SAMPLE", usage: "Comma separated prefix=rate sampling rules", value: (*sampleValue)(&c.AccessLog.Sample)},
+
+		{env: "METRICS_ADDR", usage: "Address of a separate listener serving metrics", value: (*stringValue)(&c.Metrics.Addr)},
+		{env: "METRICS_TOKEN", usage: "Bearer token required to scrape metrics", value: (*stringValue)(&c.Metrics.Token), secret: true},
+
+		{env: "TRACING_EXPORTER", usage: "Span exporter: otlp or stdout", value: (*stringValue)(&c.Tracing.Exporter)},
+		{env: "OTEL_SERVICE_NAME", usage: "Service name of the spans", value: (*stringValue)(&c.Tracing.ServiceName)},
+
+		{env: "SIGNUP_ALLOWED_DOMAINS", usage: "Comma separated email domains allowed to sign up", value: (*listValue)(&c.Accounts.Signup.AllowedDomains)},
+		{env: "SIGNUP_BLOCKED_DOMAINS", usage: "Comma separated email domains never allowed to sign up", value: (*listValue)(&c.Accounts.Signup.BlockedDomains)},
+		{env: "ACCOUNT_DELETION_GRACE_DAYS", usage: "Days during which a deleted account can be restored", value: (*daysValue)(&c.Accounts.Deletion.GracePeriod)},
+		{env: "ACCOUNT_DELETION_MODE", usage: "What happens to deleted accounts: purge or anonymize", value: (*stringValue)(&c.Accounts.Deletion.Mode)},
+
+		{env: "AUDIT_RETENTION_DAYS", usage: "Days audit events are kept, 0 keeps them forever", value: (*daysValue)(&c.Audit.Retention)},
+		{env: "JOB_BACKLOG_MAX", usage: "Pending jobs above which /readyz reports not ready", value: (*intValue)(&c.Jobs.MaxBacklog)},
+		{env: "EXPORT_DIR", usage: "Directory of the data export archives", value: (*stringValue)(&c.Exports.Dir)},
+	}
+}
+
+// value parses a setting into a field of the configuration
+type value interface {
+	Set(s string) error
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error {
+	*v = stringValue(s)
+	return nil
+}
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	parsed, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", s)
+	}
+	*v = boolValue(parsed)
+	return nil
+}
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	parsed, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	*v = intValue(parsed)
+	return nil
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected e.g. 30s or 2m", s)
+	}
+	*v = durationValue(parsed)
+	return nil
+}
+
+// daysValue reads a duration as a number of days
+type daysValue time.Duration
+
+func (v *daysValue) Set(s string) error {
+	days, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid number of days %q", s)
+	}
+	*v = daysValue(time.Duration(days) * 24 * time.Hour)
+	return nil
+}
+
+// megabytesValue reads a size in bytes as a number of megabytes
+type megabytesValue int64
+
+func (v *megabytesValue) Set(s string) error {
+	megabytes, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number of megabytes %q", s)
+	}
+	*v = megabytesValue(megabytes << 20)
+	return nil
+}
+
+// listValue reads comma separated values, trimmed and without empty entries
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	*v = values
+	return nil
+}
+
+type proxiesValue []netip.Prefix
+
+func (v *proxiesValue) Set(s string) error {
+	var values listValue
+	values.Set(s)
+	proxies, err := router.ParseTrustedProxies(values)
+	if err != nil {
+		return err
+	}
+	*v = proxies
+	return nil
+}
+
+type sampleValue []accesslog.SampleRule
+
+func (v *sampleValue) Set(s string) error {
+	var values listValue
+	values.Set(s)
+	rules, err := accesslog.ParseSampleRules(values)
+	if err != nil {
+		return err
+	}
+	*v = rules
+	return nil
+}
+
+// randomSecret returns a key that only lives as long as the process (signed
+// links won't survive a restart, sensitive columns aren't encrypted with it)
+func randomSecret() Secret {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	slog.Warn("neither SECRET_KEY nor ENCRYPTION_KEYS is set, using a random key for this process")
+	return Secret(hex.EncodeToString(bytes))
+}
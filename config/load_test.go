@@ -0,0 +1,58 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSecretFromFile(t *testing.T) {
+	dir := t.TempDir()
+	withNewline := filepath.Join(dir, "secret_key")
+	if err := os.WriteFile(withNewline, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string // Secret key, empty when Load fails
+		err  string
+	}{
+		{name: "variable", env: map[string]string{"SECRET_KEY": "from-env"}, want: "from-env"},
+		{name: "file with trailing newline", env: map[string]string{"SECRET_KEY_FILE": withNewline}, want: "from-file"},
+		{
+			name: "both set",
+			env:  map[string]string{"SECRET_KEY": "from-env", "SECRET_KEY_FILE": withNewline},
+			err:  "SECRET_KEY and SECRET_KEY_FILE are both set",
+		},
+		{
+			name: "missing file",
+			env:  map[string]string{"SECRET_KEY_FILE": filepath.Join(dir, "missing")},
+			err:  "SECRET_KEY_FILE: failed to read secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load(nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := cfg.Auth.SecretKey.Value(); got != tt.want {
+				t.Errorf("secret key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/accesslog"
+	"github.com/hyperstitieux/template/accounts"
+	"github.com/hyperstitieux/template/keyring"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/tracing"
+)
+
+// Validate checks the configuration, returning one error per invalid setting.
+// Settings are named after their key in configuration files.
+func (c Config) Validate() error {
+	v := &validator{}
+
+	if u, err := url.Parse(c.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.fail("base_url", "must be an absolute http or https URL, got %q", c.BaseURL)
+	}
+
+	if c.Debug && strings.HasPrefix(c.BaseURL, "https://") {
+		v.fail("debug", "must not be enabled with an https base_url, the error page exposes source code and headers")
+	}
+
+	v.require("server.addr", c.Server.Addr)
+	notNegative(v, "server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	notNegative(v, "server.read_timeout", c.Server.ReadTimeout)
+	notNegative(v, "server.write_timeout", c.Server.WriteTimeout)
+	notNegative(v, "server.idle_timeout", c.Server.IdleTimeout)
+	positive(v, "server.shutdown_timeout", c.Server.ShutdownTimeout)
+	notNegative(v, "server.drain_delay", c.Server.DrainDelay)
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		v.fail("server.tls_cert_file", "must be set together with server.tls_key_file")
+	}
+	if c.Server.RedirectAddr != "" && !c.Server.TLS() {
+		v.fail("server.redirect_addr", "requires server.tls_cert_file and server.tls_key_file")
+	}
+
+	v.require("database.url", c.Database.URL)
+
+	notNegative(v, "router.request_timeout", c.Router.RequestTimeout)
+	notNegative(v, "router.hsts_max_age", c.Router.HSTSMaxAge)
+	notNegative(v, "router.global_rate_limit", c.Router.GlobalRateLimit)
+	notNegative(v, "router.global_rate_burst", c.Router.GlobalRateBurst)
+	notNegative(v, "router.rate_limit_per_minute", c.Router.RateLimitPerMinute)
+	notNegative(v, "router.auth_rate_limit_per_minute", c.Router.AuthRateLimit)
+	if c.Router.GlobalRateLimit > 0 && c.Router.GlobalRateBurst == 0 {
+		v.fail("router.global_rate_burst", "must be positive when router.global_rate_limit is set")
+	}
+
+	if (c.Auth.GoogleClientID == "") != (c.Auth.GoogleClientSecret == "") {
+		v.fail("auth.google_client_id", "must be set together with auth.google_client_secret")
+	}
+	if c.Auth.EncryptionKeys == "" && len(c.Auth.SecretKey) < 32 {
+		// Not fatal, existing signed links would break
+		slog.Warn("auth.secret_key is shorter than 32 characters, signed links are easier to forge")
+	}
+	if c.Auth.EncryptionKeys != "" {
+		if _, err := keyring.Parse(c.Auth.EncryptionKeys.Value()); err != nil {
+			v.fail("auth.encryption_keys", "%v", err)
+		}
+	}
+	for _, email := range c.Auth.AdminEmails {
+		if _, err := mail.ParseAddress(email); err != nil {
+			v.fail("auth.admin_emails", "invalid email %q", email)
+		}
+	}
+
+	if c.Mail.Host != "" {
+		if port, err := strconv.Atoi(c.Mail.Port); err != nil || port < 1 || port > 65535 {
+			v.fail("mail.port", "must be a port number, got %q", c.Mail.Port)
+		}
+	}
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		v.fail("mail.from", "invalid address %q", c.Mail.From)
+	}
+
+	if _, err := logging.New(c.Logging, io.Discard); err != nil {
+		v.fail("logging", "%v", err)
+	}
+
+	if c.AccessLog.Enabled() {
+		v.oneOf("access_log.format", c.AccessLog.Format, accesslog.FormatJSON, accesslog.FormatCombined, accesslog.FormatLogfmt)
+	}
+	notNegative(v, "access_log.max_size", c.AccessLog.MaxSize)
+	notNegative(v, "access_log.rotate_every", c.AccessLog.RotateEvery)
+	notNegative(v, "access_log.max_age", c.AccessLog.MaxAge)
+	notNegative(v, "access_log.max_backups", c.AccessLog.MaxBackups)
+	for _, rule := range c.AccessLog.Sample {
+		if rule.Rate < 0 || rule.Rate > 1 {
+			v.fail("access_log.sample", "rate of %s must be between 0 and 1, got %v", rule.PathPrefix, rule.Rate)
+		}
+	}
+
+	v.oneOf("tracing.exporter", c.Tracing.Exporter, tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout)
+
+	notNegative(v, "accounts.deletion.grace_period", c.Accounts.Deletion.GracePeriod)
+	v.oneOf("accounts.deletion.mode", c.Accounts.Deletion.Mode, accounts.DeletionModePurge, accounts.DeletionModeAnonymize)
+	notNegative(v, "audit.retention", c.Audit.Retention)
+	positive(v, "jobs.max_backlog", c.Jobs.MaxBacklog)
+	v.require("exports.dir", c.Exports.Dir)
+
+	return errors.Join(v.errs...)
+}
+
+// validator collects the errors of a configuration
+type validator struct {
+	errs []error
+}
+
+func (v *validator) fail(key, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) require(key, value string) {
+	if value == "" {
+		v.fail(key, "must not be empty")
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		v.fail(key, "must be one of %q, got %q", allowed, value)
+	}
+}
+
+func positive[T int | int64 | time.Duration](v *validator, key string, value T) {
+	if value <= 0 {
+		v.fail(key, "must be positive, got %v", value)
+	}
+}
+
+func notNegative[T int | int64 | time.Duration](v *validator, key string, value T) {
+	if value < 0 {
+		v.fail(key, "must not be negative, got %v", value)
+	}
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/accounts"
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
+	"github.com/hyperstitieux/template/views/pages"
+)
+
+const adminUsersPerPage = 25
+
+type AdminController struct {
+	users    repositories.UsersRepository
+	deletion *accounts.DeletionService
+	audit    *audit.Logger
+}
+
+func NewAdminController(users repositories.UsersRepository, deletion *accounts.DeletionService, auditLogger *audit.Logger) *AdminController {
+	return &AdminController{
+		users:    users,
+		deletion: deletion,
+		audit:    auditLogger,
+	}
+}
+
+// Users renders the paginated, searchable user list
+func (c *AdminController) Users(w http.ResponseWriter, r *http.Request) error {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	filter := repositories.UserFilter{
+		Search: r.URL.Query().Get("q"),
+		Limit:  adminUsersPerPage,
+		Offset: (page - 1) * adminUsersPerPage,
+	}
+
+	users, err := c.users.ListUsers(r.Context(), filter)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	total, err := c.users.CountUsers(r.Context(), filter)
+	if err != nil {
+		return fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return pages.AdminUsers(w, r, pages.AdminUsersProps{
+		Users:   users,
+		Search:  filter.Search,
+		Page:    page,
+		PerPage: adminUsersPerPage,
+		Total:   total,
+	})
+}
+
+// User renders a user with their sessions and audit trail
+func (c *AdminController) User(w http.ResponseWriter, r *http.Request) error {
+	user, err := c.loadUser(r)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := c.users.ListSessionsByUserID(r.Context(), user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	events, _, err := c.audit.Query(r.Context(), repositories.AuditEventFilter{
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+		Limit:      50,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	return pages.AdminUser(w, r, pages.AdminUserProps{
+		User:        user,
+		Sessions:    sessions,
+		AuditEvents: events,
+	})
+}
+
+// RevokeSession revokes a single session of a user
+func (c *AdminController) RevokeSession(w http.ResponseWriter, r *http.Request) error {
+	user, err := c.loadUser(r)
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := strconv.ParseInt(mux.Vars(r)["sessionID"], 10, 64)
+	if err != nil {
+		return router.ErrNotFound
+	}
+
+	if err := c.users.DeleteSessionByID(r.Context(), sessionID, user.ID); err != nil {
+		return router.ErrNotFound
+	}
+
+	c.audit.Log(r, audit.Entry{
+		Action:     audit.ActionAdminSessionRevoked,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+		Metadata:   map[string]any{"session_id": sessionID},
+	})
+
+	return c.redirectToUser(w, r, user)
+}
+
+// RevokeSessions revokes every session of a user
+func (c *AdminController) RevokeSessions(w http.ResponseWriter, r *http.Request) error {
+	user, err := c.loadUser(r)
+	if err != nil {
+		return err
+	}
+
+	if err := c.users.DeleteSessionsByUserID(r.Context(), user.ID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	c.audit.Log(r, audit.Entry{
+		Action:     audit.ActionAdminSessionsRevoked,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+	})
+
+	return c.redirectToUser(w, r, user)
+}
+
+// Disable blocks a user from signing in and revokes their sessions
+func (c *AdminController) Disable(w http.ResponseWriter, r *http.Request) error {
+	user, err := c.loadManageableUser(r)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.DisabledAt = &now
+	user.DisabledReason = nil
+	if reason := strings.TrimSpace(r.FormValue("reason")); reason != "" {
+		user.DisabledReason = &reason
+	}
+	if err := c.users.UpdateUser(r.Context(), user); err != nil {
+		return fmt.Errorf("failed to disable user: %w", err)
+	}
+
+	if err := c.users.DeleteSessionsByUserID(r.Context(), user.ID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	c.audit.Log(r, audit.Entry{
+		Action:     audit.ActionAdminUserDisabled,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+		Metadata:   map[string]any{"reason": user.DisabledReason},
+	})
+
+	return c.redirectToUser(w, r, user)
+}
+
+// Enable lifts a previous Disable
+func (c *AdminController) Enable(w http.ResponseWriter, r *http.Request) error {
+	user, err := c.loadManageableUser(r)
+	if err != nil {
+		return err
+	}
+
+	user.DisabledAt = nil
+	user.DisabledReason = nil
+	if err := c.users.UpdateUser(r.Context(), user); err != nil {
+		return fmt.Errorf("failed to enable user: %w", err)
+	}
+
+	c.audit.Log(r, audit.Entry{
+		Action:     audit.ActionAdminUserEnabled,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+	})
+
+	return c.redirectToUser(w, r, user)
+}
+
+// Delete schedules the deletion of a user, following the same grace period
+// as a deletion requested by the user
+func (c *AdminController) Delete(w http.ResponseWriter, r *http.Request) error {
+	user, err := c.loadManageableUser(r)
+	if err != nil {
+		return err
+	}
+
+	if err := c.deletion.RequestDeletion(r.Context(), user); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	c.audit.Log(r, audit.Entry{
+		Action:     audit.ActionAdminUserDeleted,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+		Metadata:   map[string]any{"purge_after": user.PurgeAfter},
+	})
+
+	return c.redirectToUser(w, r, user)
+}
+
+// loadUser loads the user identified by the {id} route variable
+func (c *AdminController) loadUser(r *http.Request) (*models.User, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, router.ErrNotFound
+	}
+
+	user, err := c.users.GetUserByID(r.Context(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, router.ErrNotFound
+	}
+
+	return user, nil
+}
+
+// loadManageableUser loads the target user, refusing actions admins
+// would take on their own account
+func (c *AdminController) loadManageableUser(r *http.Request) (*models.User, error) {
+	user, err := c.loadUser(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if current := auth.GetCurrentUser(r); current != nil && current.ID == user.ID {
+		return nil, router.NewHTTPError(http.StatusForbidden, "you cannot perform this action on your own account")
+	}
+	if user.IsPurged() {
+		return nil, router.NewHTTPError(http.StatusConflict, "this account was deleted")
+	}
+
+	return user, nil
+}
+
+// redirectToUser sends the admin back to the user detail page
+func (c *AdminController) redirectToUser(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	http.Redirect(w, r, router.URL(routes.AdminUser, "id", strconv.FormatInt(user.ID, 10)), http.StatusSeeOther)
+	return nil
+}
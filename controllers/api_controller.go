@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/router"
+)
+
+// ProfileResponse is the public profile of the authenticated user
+type ProfileResponse struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Picture   *string   `json:"picture,omitempty"`
+	Locale    *string   `json:"locale,omitempty"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type APIController struct{}
+
+func NewAPIController() *APIController {
+	return &APIController{}
+}
+
+// Me returns the profile of the authenticated user
+func (c *APIController) Me(ctx context.Context, _ struct{}) (ProfileResponse, error) {
+	user := auth.UserFromContext(ctx)
+	if user == nil {
+		return ProfileResponse{}, router.ErrUnauthorized
+	}
+
+	return ProfileResponse{
+		ID:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Picture:   user.Picture,
+		Locale:    user.Locale,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+	}, nil
+}
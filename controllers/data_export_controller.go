@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/export"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
+)
+
+const (
+	dataExportPurpose = "data-export"
+	dataExportURLTTL  = 15 * time.Minute
+)
+
+type DataExportController struct {
+	service *export.Service
+	exports repositories.DataExportsRepository
+	audit   *audit.Logger
+	signer  *auth.Signer
+}
+
+func NewDataExportController(
+	service *export.Service,
+	exports repositories.DataExportsRepository,
+	auditLogger *audit.Logger,
+	signer *auth.Signer,
+) *DataExportController {
+	return &DataExportController{
+		service: service,
+		exports: exports,
+		audit:   auditLogger,
+		signer:  signer,
+	}
+}
+
+// Request schedules the generation of a data export for the current user
+func (c *DataExportController) Request(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, routes.SignIn(router.URL(routes.Settings)), http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	if auth.IsImpersonating(r) {
+		return errForbiddenWhileImpersonating
+	}
+
+	dataExport, err := c.service.Request(r.Context(), user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to request data export: %w", err)
+	}
+
+	c.audit.Log(r, audit.Entry{
+		Action:     audit.ActionDataExportRequested,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+		Metadata:   map[string]any{"export_id": dataExport.ID},
+	})
+
+	http.Redirect(w, r, router.URL(routes.Settings), http.StatusSeeOther)
+	return nil
+}
+
+// Download serves an export archive from a short-lived signed URL
+func (c *DataExportController) Download(w http.ResponseWriter, r *http.Request) error {
+	if auth.IsImpersonating(r) {
+		return errForbiddenWhileImpersonating
+	}
+
+	claims, err := c.signer.Verify(dataExportPurpose, r.URL.Query().Get("token"))
+	if err != nil {
+		return router.NewHTTPError(http.StatusForbidden, "download link is invalid or expired")
+	}
+
+	exportID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return router.NewHTTPError(http.StatusForbidden, "download link is invalid or expired")
+	}
+
+	dataExport, err := c.exports.GetDataExportByID(r.Context(), exportID)
+	if err != nil {
+		return fmt.Errorf("failed to get data export: %w", err)
+	}
+	if dataExport == nil || strconv.FormatInt(dataExport.UserID, 10) != claims.Value || !dataExport.IsDownloadable() {
+		return router.ErrNotFound
+	}
+
+	filename := fmt.Sprintf("data-export-%s.zip", dataExport.CreatedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeFile(w, r, filepath.Clean(*dataExport.FilePath))
+	return nil
+}
+
+// dataExportURL returns a short-lived signed download URL for a ready export
+func dataExportURL(signer *auth.Signer, dataExport *models.DataExport) (string, error) {
+	token, err := signer.Sign(
+		dataExportPurpose,
+		strconv.FormatInt(dataExport.ID, 10),
+		strconv.FormatInt(dataExport.UserID, 10),
+		dataExportURLTTL,
+	)
+	if err != nil {
+		return "", err
+	}
+	return router.URL(routes.DataExportDownload) + "?token=" + url.QueryEscape(token), nil
+}
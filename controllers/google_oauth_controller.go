@@ -8,11 +8,18 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/hyperstitieux/template/accounts"
+	"github.com/hyperstitieux/template/audit"
 	"github.com/hyperstitieux/template/auth"
 	"github.com/hyperstitieux/template/database/models"
 	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/metrics"
+	"github.com/hyperstitieux/template/tracing"
+	"github.com/hyperstitieux/template/views/pages"
 	"golang.org/x/oauth2"
 )
 
@@ -29,7 +36,11 @@ type GoogleOAuthController interface {
 
 type googleOAuthController struct {
 	users       repositories.UsersRepository
+	deletion    *accounts.DeletionService
+	audit       *audit.Logger
 	oauthConfig *oauth2.Config
+	adminEmails []string
+	signup      accounts.SignupPolicy
 }
 
 type GoogleUserInfo struct {
@@ -43,10 +54,21 @@ type GoogleUserInfo struct {
 	Locale        string `json:"locale"`
 }
 
-func NewGoogleOAuthController(users repositories.UsersRepository, oauthConfig *oauth2.Config) GoogleOAuthController {
+func NewGoogleOAuthController(
+	users repositories.UsersRepository,
+	deletion *accounts.DeletionService,
+	auditLogger *audit.Logger,
+	oauthConfig *oauth2.Config,
+	adminEmails []string,
+	signup accounts.SignupPolicy,
+) GoogleOAuthController {
 	return &googleOAuthController{
 		users:       users,
+		deletion:    deletion,
+		audit:       auditLogger,
 		oauthConfig: oauthConfig,
+		adminEmails: adminEmails,
+		signup:      signup,
 	}
 }
 
@@ -65,7 +87,7 @@ func (c *googleOAuthController) Redirect(w http.ResponseWriter, r *http.Request)
 		Path:     "/",
 		MaxAge:   600, // 10 minutes
 		HttpOnly: true,
-		Secure:   r.TLS != nil,
+		Secure:   auth.SecureCookies(),
 		SameSite: http.SameSiteLaxMode,
 	})
 
@@ -80,7 +102,7 @@ func (c *googleOAuthController) Redirect(w http.ResponseWriter, r *http.Request)
 		Path:     "/",
 		MaxAge:   600, // 10 minutes
 		HttpOnly: true,
-		Secure:   r.TLS != nil,
+		Secure:   auth.SecureCookies(),
 		SameSite: http.SameSiteLaxMode,
 	})
 
@@ -100,6 +122,7 @@ func (c *googleOAuthController) Callback(w http.ResponseWriter, r *http.Request)
 
 	state := r.URL.Query().Get("state")
 	if state != stateCookie.Value {
+		c.signInFailed(r, "invalid_state")
 		return fmt.Errorf("invalid state token")
 	}
 
@@ -131,30 +154,54 @@ func (c *googleOAuthController) Callback(w http.ResponseWriter, r *http.Request)
 		return fmt.Errorf("authorization code not found")
 	}
 
+	// Calls to Google are traced as children of the request span
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, tracing.Client())
+
 	// Exchange code for token
-	token, err := c.oauthConfig.Exchange(r.Context(), code)
+	token, err := c.oauthConfig.Exchange(ctx, code)
 	if err != nil {
+		c.signInFailed(r, "code_exchange_failed")
 		return fmt.Errorf("failed to exchange code for token: %w", err)
 	}
 
 	// Get user info from Google
-	userInfo, err := c.getUserInfo(token)
+	userInfo, err := c.getUserInfo(ctx, token)
 	if err != nil {
 		return fmt.Errorf("failed to get user info: %w", err)
 	}
 
 	// Check if user exists
-	user, err := c.users.GetUserByGoogleID(userInfo.ID)
+	user, err := c.users.GetUserByGoogleID(r.Context(), userInfo.ID)
 	if err != nil {
 		return fmt.Errorf("failed to get user: %w", err)
 	}
 
 	// Create or update user
+	action := audit.ActionSignIn
 	if user == nil {
+		action = audit.ActionSignUp
+
+		// Only allowed email domains can create an account
+		if !c.signup.Allows(userInfo.Email, userInfo.VerifiedEmail) {
+			c.signInFailed(r, "domain_not_allowed")
+			return pages.SignUpNotAllowed(w, r)
+		}
+
+		// Another account may have verified this address as its contact email
+		existing, err := c.users.GetUserByEmail(r.Context(), userInfo.Email)
+		if err != nil {
+			return fmt.Errorf("failed to check email availability: %w", err)
+		}
+		if existing != nil {
+			c.signInFailed(r, "email_in_use")
+			return pages.EmailInUse(w, r)
+		}
+
 		// Create new user
 		user = &models.User{
 			GoogleID:      userInfo.ID,
 			Email:         userInfo.Email,
+			ProviderEmail: userInfo.Email,
 			Name:          userInfo.Name,
 			GivenName:     stringPtr(userInfo.GivenName),
 			FamilyName:    stringPtr(userInfo.FamilyName),
@@ -162,21 +209,54 @@ func (c *googleOAuthController) Callback(w http.ResponseWriter, r *http.Request)
 			Locale:        stringPtr(userInfo.Locale),
 			VerifiedEmail: userInfo.VerifiedEmail,
 		}
-		if err := c.users.CreateUser(user); err != nil {
+		c.grantAdminRole(user)
+		if err := c.users.CreateUser(r.Context(), user); err != nil {
 			return fmt.Errorf("failed to create user: %w", err)
 		}
 	} else {
-		// Update existing user
-		user.Email = userInfo.Email
+		// Disabled accounts can't sign in anymore
+		if user.IsDisabled() {
+			c.signInFailed(r, "account_disabled")
+			return pages.AccountDisabled(w, r, user)
+		}
+
+		// Update existing user, keeping the contact email if the user verified their own
+		user.ProviderEmail = userInfo.Email
+		if !user.HasCustomEmail() && user.Email != userInfo.Email {
+			existing, err := c.users.GetUserByEmail(r.Context(), userInfo.Email)
+			if err != nil {
+				return fmt.Errorf("failed to check email availability: %w", err)
+			}
+			// The new Google address may be the contact email of another account
+			if existing == nil {
+				user.Email = userInfo.Email
+			} else {
+				logging.From(r.Context()).Warn("google email used by another account, keeping the previous email", "other_user_id", existing.ID)
+			}
+		}
 		user.Name = userInfo.Name
 		user.GivenName = stringPtr(userInfo.GivenName)
 		user.FamilyName = stringPtr(userInfo.FamilyName)
 		user.Picture = stringPtr(userInfo.Picture)
 		user.Locale = stringPtr(userInfo.Locale)
 		user.VerifiedEmail = userInfo.VerifiedEmail
-		if err := c.users.UpdateUser(user); err != nil {
+		c.grantAdminRole(user)
+		if err := c.users.UpdateUser(r.Context(), user); err != nil {
 			return fmt.Errorf("failed to update user: %w", err)
 		}
+
+		// Signing in during the grace period restores an account pending deletion
+		if user.IsPendingDeletion() {
+			if err := c.deletion.Restore(r.Context(), user); err != nil {
+				return err
+			}
+			c.audit.Log(r, audit.Entry{
+				ActorID:    &user.ID,
+				Action:     audit.ActionAccountRestored,
+				TargetType: audit.TargetUser,
+				TargetID:   audit.UserID(user.ID),
+			})
+		}
 	}
 
 	// Create session
@@ -190,22 +270,57 @@ func (c *googleOAuthController) Callback(w http.ResponseWriter, r *http.Request)
 		Token:     sessionToken,
 		ExpiresAt: time.Now().Add(sessionDuration),
 	}
-	if err := c.users.CreateSession(session); err != nil {
+	if err := c.users.CreateSession(r.Context(), session); err != nil {
 		return fmt.Errorf("failed to create session: %w", err)
 	}
 
 	// Set session cookie using secure cookie helper
 	auth.SetSessionCookie(w, r, sessionToken, sessionDuration)
 
+	metrics.SignIns.WithLabelValues("success", "").Inc()
+	c.audit.Log(r, audit.Entry{
+		ActorID:    &user.ID,
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+		Metadata:   map[string]any{"provider": "google", "session_id": session.ID},
+	})
+
 	// Redirect to original page or home page
 	http.Redirect(w, r, redirectTo, http.StatusTemporaryRedirect)
 	return nil
 }
 
+// grantAdminRole promotes users whose verified Google email is listed in ADMIN_EMAILS
+func (c *googleOAuthController) grantAdminRole(user *models.User) {
+	if !user.VerifiedEmail {
+		return
+	}
+	for _, email := range c.adminEmails {
+		if strings.EqualFold(email, user.ProviderEmail) {
+			user.Role = models.RoleAdmin
+			return
+		}
+	}
+}
+
+// signInFailed records a failed sign in attempt
+func (c *googleOAuthController) signInFailed(r *http.Request, reason string) {
+	metrics.SignIns.WithLabelValues("failure", reason).Inc()
+	c.audit.Log(r, audit.Entry{
+		Action:   audit.ActionSignInFailed,
+		Metadata: map[string]any{"provider": "google", "reason": reason},
+	})
+}
+
 // getUserInfo fetches user information from Google using the access token
-func (c *googleOAuthController) getUserInfo(token *oauth2.Token) (*GoogleUserInfo, error) {
-	client := c.oauthConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
+func (c *googleOAuthController) getUserInfo(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.googleapis.com/oauth2/v2/userinfo", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user info request: %w", err)
+	}
+
+	resp, err := c.oauthConfig.Client(ctx, token).Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
+)
+
+// impersonationDuration bounds how long an admin can act as another user
+const impersonationDuration = time.Hour
+
+type ImpersonationController struct {
+	users repositories.UsersRepository
+	audit *audit.Logger
+}
+
+func NewImpersonationController(users repositories.UsersRepository, auditLogger *audit.Logger) *ImpersonationController {
+	return &ImpersonationController{
+		users: users,
+		audit: auditLogger,
+	}
+}
+
+// Start replaces the admin session with a session of the target user
+// remembering the admin as impersonator
+func (c *ImpersonationController) Start(w http.ResponseWriter, r *http.Request) error {
+	admin := auth.GetCurrentUser(r)
+	if admin == nil || !admin.IsAdmin() || auth.IsImpersonating(r) {
+		return router.ErrForbidden
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return router.ErrNotFound
+	}
+
+	target, err := c.users.GetUserByID(r.Context(), id)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if target == nil {
+		return router.ErrNotFound
+	}
+	if target.ID == admin.ID || target.IsAdmin() || target.IsDisabled() || target.IsPendingDeletion() || target.IsPurged() {
+		return router.NewHTTPError(http.StatusForbidden, "this user cannot be impersonated")
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	session := &models.Session{
+		UserID:         target.ID,
+		Token:          token,
+		ImpersonatorID: &admin.ID,
+		ExpiresAt:      time.Now().Add(impersonationDuration),
+	}
+	if err := c.users.CreateSession(r.Context(), session); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	// The admin session is replaced, a fresh one is created when stopping
+	if current, err := auth.GetSessionToken(r); err == nil {
+		c.users.DeleteSession(r.Context(), current)
+	}
+
+	c.audit.Log(r, audit.Entry{
+		ActorID:    &admin.ID,
+		Action:     audit.ActionImpersonationStarted,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(target.ID),
+		Metadata:   map[string]any{"session_id": session.ID},
+	})
+
+	auth.SetSessionCookie(w, r, token, impersonationDuration)
+	http.Redirect(w, r, router.URL(routes.Home), http.StatusSeeOther)
+	return nil
+}
+
+// Stop ends the impersonation and signs the admin back in
+func (c *ImpersonationController) Stop(w http.ResponseWriter, r *http.Request) error {
+	admin := auth.GetImpersonator(r)
+	target := auth.GetCurrentUser(r)
+	if admin == nil || target == nil {
+		http.Redirect(w, r, router.URL(routes.Home), http.StatusSeeOther)
+		return nil
+	}
+
+	if current, err := auth.GetSessionToken(r); err == nil {
+		c.users.DeleteSession(r.Context(), current)
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	session := &models.Session{
+		UserID:    admin.ID,
+		Token:     token,
+		ExpiresAt: time.Now().Add(sessionDuration),
+	}
+	if err := c.users.CreateSession(r.Context(), session); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	c.audit.Log(r, audit.Entry{
+		ActorID:    &admin.ID,
+		Action:     audit.ActionImpersonationStopped,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(target.ID),
+	})
+
+	auth.SetSessionCookie(w, r, token, sessionDuration)
+	http.Redirect(w, r, router.URL(routes.AdminUser, "id", strconv.FormatInt(target.ID, 10)), http.StatusSeeOther)
+	return nil
+}
@@ -1,31 +1,102 @@
 package controllers
 
 import (
-	"log/slog"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/accounts"
+	"github.com/hyperstitieux/template/audit"
 	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
 	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/mail"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
 	"github.com/hyperstitieux/template/views/pages"
 )
 
+const (
+	emailChangePurpose = "email-change"
+	emailChangeTTL     = 24 * time.Hour
+)
+
+// errForbiddenWhileImpersonating is returned by actions admins can't take on behalf of a user
+var errForbiddenWhileImpersonating = router.NewHTTPError(http.StatusForbidden, "this action is not allowed while impersonating")
+
 type SettingsController struct {
-	users repositories.UsersRepository
+	users    repositories.UsersRepository
+	exports  repositories.DataExportsRepository
+	deletion *accounts.DeletionService
+	audit    *audit.Logger
+	mailer   mail.Mailer
+	signer   *auth.Signer
+	baseURL  string
 }
 
-func NewSettingsController(users repositories.UsersRepository) *SettingsController {
+func NewSettingsController(
+	users repositories.UsersRepository,
+	exports repositories.DataExportsRepository,
+	deletion *accounts.DeletionService,
+	auditLogger *audit.Logger,
+	mailer mail.Mailer,
+	signer *auth.Signer,
+	baseURL string,
+) *SettingsController {
 	return &SettingsController{
-		users: users,
+		users:    users,
+		exports:  exports,
+		deletion: deletion,
+		audit:    auditLogger,
+		mailer:   mailer,
+		signer:   signer,
+		baseURL:  baseURL,
 	}
 }
 
+// Show renders the settings page
+func (c *SettingsController) Show(w http.ResponseWriter, r *http.Request) error {
+	return c.render(w, r, nil)
+}
+
+// render renders the settings page with the user's latest data export
+func (c *SettingsController) render(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) error {
+	props := pages.SettingsProps{
+		Errors:              errs,
+		DeletionGracePeriod: c.deletion.GracePeriod(),
+	}
+
+	if user := auth.GetCurrentUser(r); user != nil {
+		dataExport, err := c.exports.GetLatestDataExportByUserID(r.Context(), user.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get latest data export: %w", err)
+		}
+		props.DataExport = dataExport
+
+		// The link grants the download to whoever holds it, admins included
+		if dataExport != nil && dataExport.IsDownloadable() && !auth.IsImpersonating(r) {
+			props.DataExportURL, err = dataExportURL(c.signer, dataExport)
+			if err != nil {
+				return fmt.Errorf("failed to sign data export url: %w", err)
+			}
+		}
+	}
+
+	return pages.Settings(w, r, props)
+}
+
 // UpdateProfile handles profile update requests
 func (c *SettingsController) UpdateProfile(w http.ResponseWriter, r *http.Request) error {
 	// Get authenticated user
 	user := auth.GetCurrentUser(r)
 	if user == nil {
-		http.Redirect(w, r, "/auth/google?redirect=/settings", http.StatusTemporaryRedirect)
+		http.Redirect(w, r, routes.SignIn(router.URL(routes.Settings)), http.StatusTemporaryRedirect)
 		return nil
 	}
 
@@ -37,45 +108,219 @@ func (c *SettingsController) UpdateProfile(w http.ResponseWriter, r *http.Reques
 	ok, errs := v.Validate(r)
 	if !ok {
 		// Render settings page with validation errors
-		return pages.SettingsWithErrors(w, r, errs)
+		return c.render(w, r, errs)
 	}
 
 	// Get name from form
 	name := r.FormValue("name")
 
 	// Update user name
+	previousName := user.Name
 	user.Name = name
-	if err := c.users.UpdateUser(user); err != nil {
-		slog.Error("failed to update user", "error", err, "user_id", user.ID)
-		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
-		return nil
+	if err := c.users.UpdateUser(r.Context(), user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
 	}
 
+	c.audit.Log(r, audit.Entry{
+		Action:     audit.ActionProfileUpdated,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+		Metadata:   map[string]any{"name": map[string]string{"from": previousName, "to": name}},
+	})
+
 	// Redirect back to settings page
-	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	http.Redirect(w, r, router.URL(routes.Settings), http.StatusSeeOther)
 	return nil
 }
 
+// ChangeEmail starts an email change by sending a verification link to the new address
+func (c *SettingsController) ChangeEmail(w http.ResponseWriter, r *http.Request) error {
+	// Get authenticated user
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, routes.SignIn(router.URL(routes.Settings)), http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	if auth.IsImpersonating(r) {
+		return errForbiddenWhileImpersonating
+	}
+
+	// Validate form data
+	v := validator.New(
+		validator.Field("email").Required().IsValidEmail().MaxLength(254),
+	)
+
+	ok, errs := v.Validate(r)
+	if !ok {
+		return c.render(w, r, errs)
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	if strings.EqualFold(email, user.Email) {
+		errs.Add("email", "This is already your email address")
+		return c.render(w, r, errs)
+	}
+
+	// Make sure no other account already uses this address
+	existing, err := c.users.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		return fmt.Errorf("failed to check email availability: %w", err)
+	}
+	if existing != nil && existing.ID != user.ID {
+		errs.Add("email", "This email address is already in use")
+		return c.render(w, r, errs)
+	}
+
+	// Going back to the address verified by Google doesn't need another verification
+	if user.VerifiedEmail && strings.EqualFold(email, user.ProviderEmail) {
+		previousEmail := user.Email
+		user.Email = user.ProviderEmail
+		user.PendingEmail = nil
+		user.EmailChangedAt = nil
+		if err := c.users.UpdateUser(r.Context(), user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		c.emailChanged(r, user, previousEmail)
+
+		http.Redirect(w, r, router.URL(routes.Settings), http.StatusSeeOther)
+		return nil
+	}
+
+	// Store the pending address so older links stop working when a new one is requested
+	user.PendingEmail = &email
+	if err := c.users.UpdateUser(r.Context(), user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	token, err := c.signer.Sign(emailChangePurpose, strconv.FormatInt(user.ID, 10), email, emailChangeTTL)
+	if err != nil {
+		return fmt.Errorf("failed to sign email change token: %w", err)
+	}
+
+	link := c.baseURL + router.URL(routes.SettingsVerifyEmail) + "?token=" + url.QueryEscape(token)
+	err = c.mailer.Send(r.Context(), mail.Message{
+		To:      email,
+		Subject: "Confirm your new email address",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Please confirm that you want to use this address for your account by opening the link below:\n\n" +
+			link + "\n\n" +
+			"This link expires in 24 hours. If you didn't request this change, you can ignore this email.\n",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	c.audit.Log(r, audit.Entry{
+		Action:     audit.ActionEmailChangeRequested,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+		Metadata:   map[string]any{"new_email": email},
+	})
+
+	http.Redirect(w, r, router.URL(routes.Settings), http.StatusSeeOther)
+	return nil
+}
+
+// VerifyEmail applies a pending email change from a signed verification link
+func (c *SettingsController) VerifyEmail(w http.ResponseWriter, r *http.Request) error {
+	claims, err := c.signer.Verify(emailChangePurpose, r.URL.Query().Get("token"))
+	if errors.Is(err, auth.ErrExpiredToken) {
+		return router.NewHTTPError(http.StatusBadRequest, "verification link expired")
+	}
+	if err != nil {
+		return router.NewHTTPError(http.StatusBadRequest, "invalid verification link")
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return router.NewHTTPError(http.StatusBadRequest, "invalid verification link")
+	}
+
+	user, err := c.users.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Only the most recently requested address can be confirmed
+	if user == nil || user.PendingEmail == nil || *user.PendingEmail != claims.Value {
+		return router.NewHTTPError(http.StatusBadRequest, "verification link is no longer valid")
+	}
+
+	existing, err := c.users.GetUserByEmail(r.Context(), claims.Value)
+	if err != nil {
+		return fmt.Errorf("failed to check email availability: %w", err)
+	}
+	if existing != nil && existing.ID != user.ID {
+		return router.NewHTTPError(http.StatusConflict, "email address is already in use")
+	}
+
+	previousEmail := user.Email
+	now := time.Now()
+	user.Email = claims.Value
+	user.PendingEmail = nil
+	user.EmailChangedAt = &now
+	if err := c.users.UpdateUser(r.Context(), user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	c.emailChanged(r, user, previousEmail)
+
+	http.Redirect(w, r, router.URL(routes.Settings), http.StatusSeeOther)
+	return nil
+}
+
+// emailChanged audits an applied email change and tells the previous address about it
+func (c *SettingsController) emailChanged(r *http.Request, user *models.User, previousEmail string) {
+	c.audit.Log(r, audit.Entry{
+		ActorID:    &user.ID,
+		Action:     audit.ActionEmailChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+		Metadata:   map[string]any{"from": previousEmail, "to": user.Email},
+	})
+
+	err := c.mailer.Send(r.Context(), mail.Message{
+		To:      previousEmail,
+		Subject: "Your email address was changed",
+		Body: "The email address of your account was changed to " + user.Email + ".\n\n" +
+			"If you didn't make this change, please contact support immediately.\n",
+	})
+	if err != nil {
+		// The change already happened, don't fail the request
+		logging.From(r.Context()).Error("failed to send email change notification", "error", err, "to", previousEmail)
+	}
+}
+
 // DeleteAccount handles account deletion requests
 func (c *SettingsController) DeleteAccount(w http.ResponseWriter, r *http.Request) error {
 	// Get authenticated user
 	user := auth.GetCurrentUser(r)
 	if user == nil {
-		http.Redirect(w, r, "/auth/google", http.StatusTemporaryRedirect)
+		http.Redirect(w, r, router.URL(routes.GoogleSignIn), http.StatusTemporaryRedirect)
 		return nil
 	}
 
-	// Delete user account
-	if err := c.users.DeleteUser(user.ID); err != nil {
-		slog.Error("failed to delete user", "error", err, "user_id", user.ID)
-		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
-		return nil
+	if auth.IsImpersonating(r) {
+		return errForbiddenWhileImpersonating
+	}
+
+	// Schedule account deletion, this also revokes every session
+	if err := c.deletion.RequestDeletion(r.Context(), user); err != nil {
+		return fmt.Errorf("failed to request account deletion: %w", err)
 	}
 
+	c.audit.Log(r, audit.Entry{
+		Action:     audit.ActionAccountDeletionRequest,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.UserID(user.ID),
+		Metadata:   map[string]any{"purge_after": user.PurgeAfter},
+	})
+
 	// Clear session cookie
 	auth.ClearSessionCookie(w, r)
 
 	// Redirect to home page
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, router.URL(routes.Home), http.StatusSeeOther)
 	return nil
 }
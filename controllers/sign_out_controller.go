@@ -1,11 +1,14 @@
 package controllers
 
 import (
-	"fmt"
 	"net/http"
 
+	"github.com/hyperstitieux/template/audit"
 	"github.com/hyperstitieux/template/auth"
 	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
 )
 
 type SignOutController interface {
@@ -13,35 +16,52 @@ type SignOutController interface {
 }
 
 type signOutController struct {
-	users repositories.UsersRepository
+	users         repositories.UsersRepository
+	audit         *audit.Logger
+	impersonation *ImpersonationController
 }
 
-func NewSignOutController(users repositories.UsersRepository) SignOutController {
+func NewSignOutController(users repositories.UsersRepository, auditLogger *audit.Logger, impersonation *ImpersonationController) SignOutController {
 	return &signOutController{
-		users: users,
+		users:         users,
+		audit:         auditLogger,
+		impersonation: impersonation,
 	}
 }
 
 // Handle handles user sign out by deleting the session and clearing the cookie
 func (c *signOutController) Handle(w http.ResponseWriter, r *http.Request) error {
+	// Signing out of an impersonation ends it, the admin session was replaced when it started
+	if auth.IsImpersonating(r) {
+		return c.impersonation.Stop(w, r)
+	}
+
 	// Get session token from cookie
 	token, err := auth.GetSessionToken(r)
 	if err != nil {
 		// No session cookie - just redirect
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		http.Redirect(w, r, router.URL(routes.Home), http.StatusTemporaryRedirect)
 		return nil
 	}
 
+	if user := auth.GetCurrentUser(r); user != nil {
+		c.audit.Log(r, audit.Entry{
+			Action:     audit.ActionSignOut,
+			TargetType: audit.TargetUser,
+			TargetID:   audit.UserID(user.ID),
+		})
+	}
+
 	// Delete session from database
-	if err := c.users.DeleteSession(token); err != nil {
+	if err := c.users.DeleteSession(r.Context(), token); err != nil {
 		// Log error but continue with logout
-		fmt.Printf("failed to delete session: %v\n", err)
+		logging.From(r.Context()).Error("failed to delete session", "error", err)
 	}
 
 	// Clear session cookie
 	auth.ClearSessionCookie(w, r)
 
 	// Redirect to home page
-	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	http.Redirect(w, r, router.URL(routes.Home), http.StatusTemporaryRedirect)
 	return nil
 }
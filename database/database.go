@@ -1,9 +1,13 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
@@ -11,13 +15,16 @@ import (
 //go:embed schema.sql
 var schemaFS embed.FS
 
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
 type Database struct {
 	DB *sql.DB
 }
 
 // New initializes a new SQLite database connection and runs migrations
 func New(databaseURL string) (*Database, error) {
-	db, err := sql.Open("sqlite", databaseURL)
+	db, err := sql.Open("sqlite", withPragmas(databaseURL))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -37,9 +44,149 @@ func New(databaseURL string) (*Database, error) {
 		return nil, fmt.Errorf("failed to execute schema: %w", err)
 	}
 
+	// Apply incremental migrations on top of the base schema
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+
 	return &Database{DB: db}, nil
 }
 
+// withPragmas adds the options every pooled connection needs to the DSN:
+// foreign keys (disabled by default in SQLite), a busy timeout so that
+// concurrent writers (HTTP handlers, job workers) wait instead of failing,
+// and a sortable time format so DATETIME columns compare correctly
+func withPragmas(databaseURL string) string {
+	separator := "?"
+	if strings.Contains(databaseURL, "?") {
+		separator = "&"
+	}
+
+	pragmas := []string{}
+	if !strings.Contains(databaseURL, "foreign_keys") {
+		pragmas = append(pragmas, "_pragma=foreign_keys(1)")
+	}
+	if !strings.Contains(databaseURL, "busy_timeout") {
+		pragmas = append(pragmas, "_pragma=busy_timeout(5000)")
+	}
+	if !strings.Contains(databaseURL, "_time_format") {
+		pragmas = append(pragmas, "_time_format=sqlite")
+	}
+	if len(pragmas) == 0 {
+		return databaseURL
+	}
+
+	return databaseURL + separator + strings.Join(pragmas, "&")
+}
+
+// migrate applies every embedded migration that has not been recorded in
+// schema_migrations yet, in lexical order of their file names
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version TEXT PRIMARY KEY,
+			applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	names, err := migrationNames()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		version := migrationVersion(name)
+
+		var applied int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, version).Scan(&applied); err != nil {
+			return fmt.Errorf("failed to check migration %s: %w", version, err)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		content, err := migrationsFS.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", version, err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %s: %w", version, err)
+		}
+		if _, err := tx.Exec(string(content)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %s: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %s: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// migrationNames lists the embedded migration files in the order they are applied
+func migrationNames() ([]string, error) {
+	names, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// migrationVersion returns the version recorded in schema_migrations for a migration file
+func migrationVersion(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+}
+
+// Ping checks the database can be reached
+func (d *Database) Ping(ctx context.Context) error {
+	return d.DB.PingContext(ctx)
+}
+
+// PendingMigrations returns the versions of the embedded migrations that
+// aren't applied to the database
+func (d *Database) PendingMigrations(ctx context.Context) ([]string, error) {
+	names, err := migrationNames()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.DB.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+
+	var pending []string
+	for _, name := range names {
+		if version := migrationVersion(name); !applied[version] {
+			pending = append(pending, version)
+		}
+	}
+	return pending, nil
+}
+
 // Close closes the database connection
 func (d *Database) Close() error {
 	return d.DB.Close()
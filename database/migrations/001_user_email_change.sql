@@ -0,0 +1,8 @@
+-- Email change flow
+-- provider_email mirrors the address reported by Google on every sign in,
+-- while email holds the contact address chosen and verified by the user.
+ALTER TABLE users ADD COLUMN provider_email TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN pending_email TEXT;
+ALTER TABLE users ADD COLUMN email_changed_at DATETIME;
+
+UPDATE users SET provider_email = email WHERE provider_email = '';
@@ -0,0 +1,7 @@
+-- Soft delete
+-- deleted_at is set when the user asks to delete their account, the account
+-- is purged (or anonymized) once purge_after is reached unless restored.
+ALTER TABLE users ADD COLUMN deleted_at DATETIME;
+ALTER TABLE users ADD COLUMN purge_after DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_users_purge_after ON users(purge_after);
@@ -0,0 +1,4 @@
+-- Roles and account disabling
+-- role grants access to the admin area, disabled_at blocks sign in and sessions
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN disabled_at DATETIME;
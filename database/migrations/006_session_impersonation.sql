@@ -0,0 +1,3 @@
+-- Impersonation
+-- impersonator_id is the admin who started an impersonation session
+ALTER TABLE sessions ADD COLUMN impersonator_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
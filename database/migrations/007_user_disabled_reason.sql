@@ -0,0 +1,2 @@
+-- Suspension reason shown to blocked users
+ALTER TABLE users ADD COLUMN disabled_reason TEXT;
@@ -0,0 +1,9 @@
+-- Purged accounts
+-- purged_at is set once an account is anonymized: the row is kept but no
+-- longer belongs to anyone, it can neither be restored nor signed in to.
+ALTER TABLE users ADD COLUMN purged_at DATETIME;
+
+-- Rows anonymized before this migration kept their Google ID
+UPDATE users
+SET google_id = 'deleted-' || id, purge_after = NULL, purged_at = CURRENT_TIMESTAMP
+WHERE email = 'deleted-' || id || '@deleted.invalid';
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+type DataExport struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	FilePath    *string    `json:"-"`
+	Error       *string    `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// IsDownloadable reports whether the archive is ready and not expired yet
+func (e *DataExport) IsDownloadable() bool {
+	return e.Status == DataExportReady && e.FilePath != nil &&
+		e.ExpiresAt != nil && time.Now().Before(*e.ExpiresAt)
+}
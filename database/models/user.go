@@ -2,24 +2,66 @@ package models
 
 import "time"
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	ID            int64     `json:"id"`
-	GoogleID      string    `json:"google_id"`
-	Email         string    `json:"email"`
-	Name          string    `json:"name"`
-	GivenName     *string   `json:"given_name,omitempty"`
-	FamilyName    *string   `json:"family_name,omitempty"`
-	Picture       *string   `json:"picture,omitempty"`
-	Locale        *string   `json:"locale,omitempty"`
-	VerifiedEmail bool      `json:"verified_email"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID             int64      `json:"id"`
+	GoogleID       string     `json:"google_id"`
+	Email          string     `json:"email"`
+	ProviderEmail  string     `json:"provider_email"`
+	PendingEmail   *string    `json:"pending_email,omitempty"`
+	EmailChangedAt *time.Time `json:"email_changed_at,omitempty"`
+	Name           string     `json:"name"`
+	GivenName      *string    `json:"given_name,omitempty"`
+	FamilyName     *string    `json:"family_name,omitempty"`
+	Picture        *string    `json:"picture,omitempty"`
+	Locale         *string    `json:"locale,omitempty"`
+	VerifiedEmail  bool       `json:"verified_email"`
+	Role           string     `json:"role"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason *string    `json:"disabled_reason,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	PurgeAfter     *time.Time `json:"purge_after,omitempty"`
+	PurgedAt       *time.Time `json:"purged_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// HasCustomEmail reports whether the user picked a contact email that
+// should no longer follow the provider email
+func (u *User) HasCustomEmail() bool {
+	return u.EmailChangedAt != nil
+}
+
+// IsAdmin reports whether the user can access the admin area
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// IsDisabled reports whether the account was disabled by an administrator
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// IsPendingDeletion reports whether the user asked to delete their account
+// and the grace period is still running
+func (u *User) IsPendingDeletion() bool {
+	return u.DeletedAt != nil && u.PurgedAt == nil
+}
+
+// IsPurged reports whether the account was anonymized once its grace period ended
+func (u *User) IsPurged() bool {
+	return u.PurgedAt != nil
 }
 
 type Session struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"user_id"`
+	Token          string    `json:"token"`
+	ImpersonatorID *int64    `json:"impersonator_id,omitempty"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
 }
@@ -0,0 +1,318 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/keyring"
+	"github.com/hyperstitieux/template/logging"
+)
+
+// AuditEventFilter narrows down audit event queries, zero values are ignored
+type AuditEventFilter struct {
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+type AuditEventsRepository interface {
+	CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, filter AuditEventFilter) ([]*models.AuditEvent, error)
+	CountAuditEvents(ctx context.Context, filter AuditEventFilter) (int, error)
+	DeleteAuditEventsBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	ReencryptAuditEvents(ctx context.Context, afterID int64, limit int) (ReencryptProgress, error)
+}
+
+// ReencryptProgress reports a batch of ReencryptAuditEvents
+type ReencryptProgress struct {
+	LastID   int64 // ID of the last event examined, where the next batch starts
+	Examined int
+	Updated  int
+	Skipped  int // Events encrypted with a key missing from the ring
+}
+
+// auditEventColumns lists the audit_events columns in the order expected by scanAuditEvent
+const auditEventColumns = `id, actor_id, action, target_type, target_id, ip, user_agent, request_id, metadata, created_at`
+
+// scanAuditEvent scans a row selected with auditEventColumns into an AuditEvent
+func scanAuditEvent(row rowScanner) (*models.AuditEvent, error) {
+	var (
+		event      models.AuditEvent
+		targetType sql.NullString
+		targetID   sql.NullString
+		ip         sql.NullString
+		userAgent  sql.NullString
+		requestID  sql.NullString
+		metadata   sql.NullString
+	)
+
+	err := row.Scan(
+		&event.ID,
+		&event.ActorID,
+		&event.Action,
+		&targetType,
+		&targetID,
+		&ip,
+		&userAgent,
+		&requestID,
+		&metadata,
+		&event.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	event.TargetType = targetType.String
+	event.TargetID = targetID.String
+	event.IP = ip.String
+	event.UserAgent = userAgent.String
+	event.RequestID = requestID.String
+	if metadata.Valid && metadata.String != "" {
+		if err := json.Unmarshal([]byte(metadata.String), &event.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode audit metadata: %w", err)
+		}
+	}
+
+	return &event, nil
+}
+
+// auditEventsRepository encrypts the IP and user agent of the events, they
+// identify people and outlive their accounts
+type auditEventsRepository struct {
+	db   tracedDB
+	ring *keyring.Ring
+}
+
+// NewAuditEventsRepository creates the repository, the IP and user agent of
+// new events are stored in plain text when ring is nil
+func NewAuditEventsRepository(db *sql.DB, ring *keyring.Ring) AuditEventsRepository {
+	return &auditEventsRepository{db: tracedDB{db}, ring: ring}
+}
+
+// decrypt replaces the encrypted columns of a scanned event by their value. A
+// column that can't be decrypted is replaced by a placeholder rather than
+// failing the whole query, and decrypt reports false.
+func (r *auditEventsRepository) decrypt(ctx context.Context, event *models.AuditEvent) bool {
+	ok := true
+	for _, column := range []*string{&event.IP, &event.UserAgent} {
+		value, err := decryptColumn(r.ring, *column)
+		if err != nil {
+			logging.From(ctx).Warn("failed to decrypt audit event", "error", err, "audit_event_id", event.ID)
+			value, ok = undecryptable, false
+		}
+		*column = value
+	}
+	return ok
+}
+
+// CreateAuditEvent stores a new audit event
+func (r *auditEventsRepository) CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	var metadata *string
+	if len(event.Metadata) > 0 {
+		data, err := json.Marshal(event.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit metadata: %w", err)
+		}
+		encoded := string(data)
+		metadata = &encoded
+	}
+
+	ip, err := encryptColumn(r.ring, event.IP)
+	if err != nil {
+		return err
+	}
+	userAgent, err := encryptColumn(r.ring, event.UserAgent)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_events (actor_id, action, target_type, target_id, ip, user_agent, request_id, metadata, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	event.CreatedAt = time.Now()
+	result, err := r.db.ExecContext(ctx,
+		query,
+		event.ActorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		ip,
+		userAgent,
+		event.RequestID,
+		metadata,
+		event.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	event.ID = id
+
+	return nil
+}
+
+// ListAuditEvents lists audit events matching the filter, newest first
+func (r *auditEventsRepository) ListAuditEvents(ctx context.Context, filter AuditEventFilter) ([]*models.AuditEvent, error) {
+	where, args := auditEventWhere(filter)
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events` + where + ` ORDER BY id DESC`
+
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*models.AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		r.decrypt(ctx, event)
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// CountAuditEvents counts audit events matching the filter
+func (r *auditEventsRepository) CountAuditEvents(ctx context.Context, filter AuditEventFilter) (int, error) {
+	where, args := auditEventWhere(filter)
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_events`+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	return count, nil
+}
+
+// DeleteAuditEventsBefore deletes events older than cutoff and returns how many were removed
+func (r *auditEventsRepository) DeleteAuditEventsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM audit_events WHERE created_at < ?`, cutoff.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete audit events: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// ReencryptAuditEvents encrypts with the primary key up to limit events after
+// afterID whose IP or user agent is in plain text or encrypted with an older
+// key. Events whose key left the ring are skipped. Once no batch updates nor
+// skips an event the older keys may leave the ring.
+func (r *auditEventsRepository) ReencryptAuditEvents(ctx context.Context, afterID int64, limit int) (ReencryptProgress, error) {
+	var progress ReencryptProgress
+	if r.ring == nil {
+		return progress, nil
+	}
+
+	prefix := r.ring.Primary().CiphertextPrefix()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, COALESCE(ip, ''), COALESCE(user_agent, '') FROM audit_events
+		WHERE id > ? AND ((ip != '' AND substr(ip, 1, ?) != ?) OR (user_agent != '' AND substr(user_agent, 1, ?) != ?))
+		ORDER BY id LIMIT ?
+	`, afterID, len(prefix), prefix, len(prefix), prefix, limit)
+	if err != nil {
+		return progress, fmt.Errorf("failed to list audit events to re-encrypt: %w", err)
+	}
+
+	var events []*models.AuditEvent
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := rows.Scan(&event.ID, &event.IP, &event.UserAgent); err != nil {
+			rows.Close()
+			return progress, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return progress, fmt.Errorf("failed to list audit events to re-encrypt: %w", err)
+	}
+
+	// Rows are updated once all are read, SQLite would lock the table while iterating
+	for _, event := range events {
+		progress.LastID = event.ID
+		progress.Examined++
+		if !r.decrypt(ctx, event) {
+			progress.Skipped++
+			continue
+		}
+		ip, err := encryptColumn(r.ring, event.IP)
+		if err != nil {
+			return progress, err
+		}
+		userAgent, err := encryptColumn(r.ring, event.UserAgent)
+		if err != nil {
+			return progress, err
+		}
+		if _, err := r.db.ExecContext(ctx, `UPDATE audit_events SET ip = ?, user_agent = ? WHERE id = ?`, ip, userAgent, event.ID); err != nil {
+			return progress, fmt.Errorf("failed to re-encrypt audit event %d: %w", event.ID, err)
+		}
+		progress.Updated++
+	}
+
+	return progress, nil
+}
+
+// auditEventWhere builds the WHERE clause of a filter
+func auditEventWhere(filter AuditEventFilter) (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+
+	if filter.ActorID != 0 {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, filter.ActorID)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC())
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,206 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type DataExportsRepository interface {
+	CreateDataExport(ctx context.Context, export *models.DataExport) error
+	GetDataExportByID(ctx context.Context, id int64) (*models.DataExport, error)
+	GetLatestDataExportByUserID(ctx context.Context, userID int64) (*models.DataExport, error)
+	UpdateDataExport(ctx context.Context, export *models.DataExport) error
+	ListDataExportsByUserID(ctx context.Context, userID int64) ([]*models.DataExport, error)
+	ListExpiredDataExports(ctx context.Context, now time.Time) ([]*models.DataExport, error)
+	DeleteDataExport(ctx context.Context, id int64) error
+}
+
+// dataExportColumns lists the data_exports columns in the order expected by scanDataExport
+const dataExportColumns = `id, user_id, status, file_path, error, created_at, completed_at, expires_at`
+
+// scanDataExport scans a row selected with dataExportColumns into a DataExport
+func scanDataExport(row rowScanner) (*models.DataExport, error) {
+	export := &models.DataExport{}
+	err := row.Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.FilePath,
+		&export.Error,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+type dataExportsRepository struct {
+	db tracedDB
+}
+
+func NewDataExportsRepository(db *sql.DB) DataExportsRepository {
+	return &dataExportsRepository{db: tracedDB{db}}
+}
+
+// CreateDataExport records a new export request
+func (r *dataExportsRepository) CreateDataExport(ctx context.Context, export *models.DataExport) error {
+	query := `INSERT INTO data_exports (user_id, status) VALUES (?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query, export.UserID, export.Status)
+	if err != nil {
+		return fmt.Errorf("failed to create data export: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	export.ID = id
+	export.CreatedAt = time.Now()
+
+	return nil
+}
+
+// GetDataExportByID retrieves an export by its ID
+func (r *dataExportsRepository) GetDataExportByID(ctx context.Context, id int64) (*models.DataExport, error) {
+	query := `
+		SELECT ` + dataExportColumns + `
+		FROM data_exports
+		WHERE id = ?
+	`
+
+	export, err := scanDataExport(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data export by id: %w", err)
+	}
+
+	return export, nil
+}
+
+// GetLatestDataExportByUserID retrieves the most recent export of a user
+func (r *dataExportsRepository) GetLatestDataExportByUserID(ctx context.Context, userID int64) (*models.DataExport, error) {
+	query := `
+		SELECT ` + dataExportColumns + `
+		FROM data_exports
+		WHERE user_id = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`
+
+	export, err := scanDataExport(r.db.QueryRowContext(ctx, query, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest data export: %w", err)
+	}
+
+	return export, nil
+}
+
+// UpdateDataExport updates the status and archive details of an export
+func (r *dataExportsRepository) UpdateDataExport(ctx context.Context, export *models.DataExport) error {
+	query := `
+		UPDATE data_exports
+		SET status = ?, file_path = ?, error = ?, completed_at = ?, expires_at = ?
+		WHERE id = ?
+	`
+
+	result, err := r.db.ExecContext(ctx,
+		query,
+		export.Status,
+		export.FilePath,
+		export.Error,
+		export.CompletedAt,
+		export.ExpiresAt,
+		export.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update data export: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("data export not found")
+	}
+
+	return nil
+}
+
+// ListDataExportsByUserID lists every export of a user
+func (r *dataExportsRepository) ListDataExportsByUserID(ctx context.Context, userID int64) ([]*models.DataExport, error) {
+	query := `
+		SELECT ` + dataExportColumns + `
+		FROM data_exports
+		WHERE user_id = ?
+	`
+
+	exports, err := r.list(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list data exports: %w", err)
+	}
+
+	return exports, nil
+}
+
+// ListExpiredDataExports lists exports whose archive expired before now
+func (r *dataExportsRepository) ListExpiredDataExports(ctx context.Context, now time.Time) ([]*models.DataExport, error) {
+	query := `
+		SELECT ` + dataExportColumns + `
+		FROM data_exports
+		WHERE expires_at IS NOT NULL AND expires_at <= ?
+	`
+
+	exports, err := r.list(ctx, query, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired data exports: %w", err)
+	}
+
+	return exports, nil
+}
+
+// list runs a query selecting dataExportColumns and scans every row
+func (r *dataExportsRepository) list(ctx context.Context, query string, args ...any) ([]*models.DataExport, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exports []*models.DataExport
+	for rows.Next() {
+		export, err := scanDataExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+
+	return exports, rows.Err()
+}
+
+// DeleteDataExport deletes an export record
+func (r *dataExportsRepository) DeleteDataExport(ctx context.Context, id int64) error {
+	query := `DELETE FROM data_exports WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete data export: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/hyperstitieux/template/keyring"
+)
+
+// undecryptable replaces the value of a column whose key left the ring
+const undecryptable = "[undecryptable]"
+
+// encryptColumn encrypts a sensitive value with the primary key before it is
+// stored. Empty values are stored as is, as are all values without a ring
+// (keys generated for the process would make them unreadable after a restart).
+func encryptColumn(ring *keyring.Ring, value string) (string, error) {
+	if value == "" || ring == nil {
+		return value, nil
+	}
+	encrypted, err := ring.Encrypt([]byte(value))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt column: %w", err)
+	}
+	return encrypted, nil
+}
+
+// decryptColumn returns the value of a column written by encryptColumn with any
+// key of the ring. Values stored before the column was encrypted are returned as is.
+func decryptColumn(ring *keyring.Ring, value string) (string, error) {
+	if !keyring.IsEncrypted(value) {
+		return value, nil
+	}
+	if ring == nil {
+		return "", fmt.Errorf("failed to decrypt column: %w", keyring.ErrUnknownKey)
+	}
+	decrypted, err := ring.Decrypt(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt column: %w", err)
+	}
+	return string(decrypted), nil
+}
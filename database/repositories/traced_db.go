@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/hyperstitieux/template/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedDB runs the queries of the repositories in child spans of the request
+type tracedDB struct {
+	db *sql.DB
+}
+
+func (t tracedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	result, err := t.db.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return result, err
+}
+
+// QueryContext spans only cover the query execution, not the iteration of the rows
+func (t tracedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	tracing.End(span, err)
+	return rows, err
+}
+
+// QueryRowContext errors are only known once scanned, they aren't recorded on the span
+func (t tracedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+	return t.db.QueryRowContext(ctx, query, args...)
+}
+
+// startQuerySpan starts a span named after the operation and table of the query
+// (e.g. "SELECT users"), the arguments are never recorded
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	query = strings.TrimSpace(query)
+	operation, table := queryTarget(query)
+
+	name := operation
+	if table != "" {
+		name += " " + table
+	}
+
+	return tracing.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "sqlite"),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.collection.name", table),
+			attribute.String("db.query.text", query),
+		),
+	)
+}
+
+// queryTarget returns the operation of a query and the first table it reads or writes
+func queryTarget(query string) (string, string) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return "", ""
+	}
+	operation := strings.ToUpper(words[0])
+
+	for i, word := range words[:len(words)-1] {
+		switch strings.ToUpper(word) {
+		case "FROM", "INTO", "UPDATE":
+			return operation, strings.Trim(words[i+1], "();")
+		}
+	}
+	return operation, ""
+}
@@ -1,55 +1,125 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hyperstitieux/template/database/models"
 )
 
+// UserFilter narrows down user listings, zero values are ignored
+type UserFilter struct {
+	Search string // Matches name or email
+	Limit  int
+	Offset int
+}
+
 type UsersRepository interface {
 	// User operations
-	CreateUser(user *models.User) error
-	GetUserByID(id int64) (*models.User, error)
-	GetUserByGoogleID(googleID string) (*models.User, error)
-	GetUserByEmail(email string) (*models.User, error)
-	UpdateUser(user *models.User) error
-	DeleteUser(id int64) error
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByID(ctx context.Context, id int64) (*models.User, error)
+	GetUserByGoogleID(ctx context.Context, googleID string) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	DeleteUser(ctx context.Context, id int64) error
+	AnonymizeUser(ctx context.Context, id int64) error
+	ListUsers(ctx context.Context, filter UserFilter) ([]*models.User, error)
+	CountUsers(ctx context.Context, filter UserFilter) (int, error)
+	ListUsersDueForPurge(ctx context.Context, now time.Time) ([]*models.User, error)
 
 	// Session operations
-	CreateSession(session *models.Session) error
-	GetSessionByToken(token string) (*models.Session, error)
-	GetUserBySessionToken(token string) (*models.User, error)
-	DeleteSession(token string) error
-	DeleteExpiredSessions() error
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSessionByToken(ctx context.Context, token string) (*models.Session, error)
+	GetUserBySessionToken(ctx context.Context, token string) (*models.User, error)
+	ListSessionsByUserID(ctx context.Context, userID int64) ([]*models.Session, error)
+	DeleteSession(ctx context.Context, token string) error
+	DeleteSessionByID(ctx context.Context, id, userID int64) error
+	DeleteSessionsByUserID(ctx context.Context, userID int64) error
+	DeleteExpiredSessions(ctx context.Context) error
+}
+
+// userColumns lists the users columns in the order expected by scanUser
+const userColumns = `id, google_id, email, provider_email, pending_email, email_changed_at, name, given_name, family_name, picture, locale, verified_email, role, disabled_at, disabled_reason, deleted_at, purge_after, purged_at, created_at, updated_at`
+
+// prefixedUserColumns qualifies userColumns with a table alias for joins
+func prefixedUserColumns(alias string) string {
+	columns := strings.Split(userColumns, ", ")
+	for i, column := range columns {
+		columns[i] = alias + "." + column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser scans a row selected with userColumns into a User
+func scanUser(row rowScanner) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(
+		&user.ID,
+		&user.GoogleID,
+		&user.Email,
+		&user.ProviderEmail,
+		&user.PendingEmail,
+		&user.EmailChangedAt,
+		&user.Name,
+		&user.GivenName,
+		&user.FamilyName,
+		&user.Picture,
+		&user.Locale,
+		&user.VerifiedEmail,
+		&user.Role,
+		&user.DisabledAt,
+		&user.DisabledReason,
+		&user.DeletedAt,
+		&user.PurgeAfter,
+		&user.PurgedAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 type usersRepository struct {
-	db *sql.DB
+	db tracedDB
 }
 
 func NewUsersRepository(db *sql.DB) UsersRepository {
-	return &usersRepository{db: db}
+	return &usersRepository{db: tracedDB{db}}
 }
 
 // CreateUser creates a new user in the database
-func (r *usersRepository) CreateUser(user *models.User) error {
+func (r *usersRepository) CreateUser(ctx context.Context, user *models.User) error {
 	query := `
-		INSERT INTO users (google_id, email, name, given_name, family_name, picture, locale, verified_email)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO users (google_id, email, provider_email, name, given_name, family_name, picture, locale, verified_email, role)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := r.db.Exec(
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+
+	result, err := r.db.ExecContext(ctx,
 		query,
 		user.GoogleID,
 		user.Email,
+		user.ProviderEmail,
 		user.Name,
 		user.GivenName,
 		user.FamilyName,
 		user.Picture,
 		user.Locale,
 		user.VerifiedEmail,
+		user.Role,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
@@ -68,27 +138,14 @@ func (r *usersRepository) CreateUser(user *models.User) error {
 }
 
 // GetUserByID retrieves a user by their ID
-func (r *usersRepository) GetUserByID(id int64) (*models.User, error) {
+func (r *usersRepository) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
 	query := `
-		SELECT id, google_id, email, name, given_name, family_name, picture, locale, verified_email, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = ?
 	`
 
-	user := &models.User{}
-	err := r.db.QueryRow(query, id).Scan(
-		&user.ID,
-		&user.GoogleID,
-		&user.Email,
-		&user.Name,
-		&user.GivenName,
-		&user.FamilyName,
-		&user.Picture,
-		&user.Locale,
-		&user.VerifiedEmail,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -99,28 +156,16 @@ func (r *usersRepository) GetUserByID(id int64) (*models.User, error) {
 	return user, nil
 }
 
-// GetUserByGoogleID retrieves a user by their Google ID
-func (r *usersRepository) GetUserByGoogleID(googleID string) (*models.User, error) {
+// GetUserByGoogleID retrieves a user by their Google ID, purged users
+// don't belong to anyone anymore and are never returned
+func (r *usersRepository) GetUserByGoogleID(ctx context.Context, googleID string) (*models.User, error) {
 	query := `
-		SELECT id, google_id, email, name, given_name, family_name, picture, locale, verified_email, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
-		WHERE google_id = ?
+		WHERE google_id = ? AND purged_at IS NULL
 	`
 
-	user := &models.User{}
-	err := r.db.QueryRow(query, googleID).Scan(
-		&user.ID,
-		&user.GoogleID,
-		&user.Email,
-		&user.Name,
-		&user.GivenName,
-		&user.FamilyName,
-		&user.Picture,
-		&user.Locale,
-		&user.VerifiedEmail,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, googleID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -132,27 +177,14 @@ func (r *usersRepository) GetUserByGoogleID(googleID string) (*models.User, erro
 }
 
 // GetUserByEmail retrieves a user by their email address
-func (r *usersRepository) GetUserByEmail(email string) (*models.User, error) {
+func (r *usersRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, google_id, email, name, given_name, family_name, picture, locale, verified_email, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = ?
 	`
 
-	user := &models.User{}
-	err := r.db.QueryRow(query, email).Scan(
-		&user.ID,
-		&user.GoogleID,
-		&user.Email,
-		&user.Name,
-		&user.GivenName,
-		&user.FamilyName,
-		&user.Picture,
-		&user.Locale,
-		&user.VerifiedEmail,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, email))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -164,22 +196,30 @@ func (r *usersRepository) GetUserByEmail(email string) (*models.User, error) {
 }
 
 // UpdateUser updates an existing user's information
-func (r *usersRepository) UpdateUser(user *models.User) error {
+func (r *usersRepository) UpdateUser(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users
-		SET email = ?, name = ?, given_name = ?, family_name = ?, picture = ?, locale = ?, verified_email = ?
+		SET email = ?, provider_email = ?, pending_email = ?, email_changed_at = ?, name = ?, given_name = ?, family_name = ?, picture = ?, locale = ?, verified_email = ?, role = ?, disabled_at = ?, disabled_reason = ?, deleted_at = ?, purge_after = ?
 		WHERE id = ?
 	`
 
-	result, err := r.db.Exec(
+	result, err := r.db.ExecContext(ctx,
 		query,
 		user.Email,
+		user.ProviderEmail,
+		user.PendingEmail,
+		user.EmailChangedAt,
 		user.Name,
 		user.GivenName,
 		user.FamilyName,
 		user.Picture,
 		user.Locale,
 		user.VerifiedEmail,
+		user.Role,
+		user.DisabledAt,
+		user.DisabledReason,
+		user.DeletedAt,
+		user.PurgeAfter,
 		user.ID,
 	)
 	if err != nil {
@@ -199,10 +239,10 @@ func (r *usersRepository) UpdateUser(user *models.User) error {
 }
 
 // DeleteUser deletes a user by their ID
-func (r *usersRepository) DeleteUser(id int64) error {
+func (r *usersRepository) DeleteUser(ctx context.Context, id int64) error {
 	query := `DELETE FROM users WHERE id = ?`
 
-	result, err := r.db.Exec(query, id)
+	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -219,17 +259,122 @@ func (r *usersRepository) DeleteUser(id int64) error {
 	return nil
 }
 
+// AnonymizeUser strips the personal data of a user, Google ID included, and
+// marks it purged. Unique placeholders keep the UNIQUE constraints satisfied.
+func (r *usersRepository) AnonymizeUser(ctx context.Context, id int64) error {
+	query := `
+		UPDATE users
+		SET google_id = 'deleted-' || id, email = 'deleted-' || id || '@deleted.invalid', provider_email = 'deleted-' || id || '@deleted.invalid',
+			pending_email = NULL, email_changed_at = NULL, name = 'Deleted user', given_name = NULL, family_name = NULL, picture = NULL,
+			locale = NULL, verified_email = 0, purge_after = NULL, purged_at = ?
+		WHERE id = ? AND purged_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to anonymize user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// ListUsers lists users matching the filter, newest first
+func (r *usersRepository) ListUsers(ctx context.Context, filter UserFilter) ([]*models.User, error) {
+	where, args := userWhere(filter)
+	query := `SELECT ` + userColumns + ` FROM users` + where + ` ORDER BY id DESC`
+
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// CountUsers counts users matching the filter
+func (r *usersRepository) CountUsers(ctx context.Context, filter UserFilter) (int, error) {
+	where, args := userWhere(filter)
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return count, nil
+}
+
+// userWhere builds the WHERE clause of a filter
+func userWhere(filter UserFilter) (string, []any) {
+	if filter.Search == "" {
+		return "", nil
+	}
+
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Search) + "%"
+	return ` WHERE name LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\'`, []any{pattern, pattern}
+}
+
+// ListUsersDueForPurge lists users pending deletion whose grace period ended before now
+func (r *usersRepository) ListUsersDueForPurge(ctx context.Context, now time.Time) ([]*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE deleted_at IS NOT NULL AND purged_at IS NULL AND purge_after <= ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users due for purge: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
 // CreateSession creates a new session for a user
-func (r *usersRepository) CreateSession(session *models.Session) error {
+func (r *usersRepository) CreateSession(ctx context.Context, session *models.Session) error {
 	query := `
-		INSERT INTO sessions (user_id, token, expires_at)
-		VALUES (?, ?, ?)
+		INSERT INTO sessions (user_id, token, impersonator_id, expires_at)
+		VALUES (?, ?, ?, ?)
 	`
 
-	result, err := r.db.Exec(
+	result, err := r.db.ExecContext(ctx,
 		query,
 		session.UserID,
 		session.Token,
+		session.ImpersonatorID,
 		session.ExpiresAt,
 	)
 	if err != nil {
@@ -248,18 +393,19 @@ func (r *usersRepository) CreateSession(session *models.Session) error {
 }
 
 // GetSessionByToken retrieves a session by its token
-func (r *usersRepository) GetSessionByToken(token string) (*models.Session, error) {
+func (r *usersRepository) GetSessionByToken(ctx context.Context, token string) (*models.Session, error) {
 	query := `
-		SELECT id, user_id, token, expires_at, created_at
+		SELECT id, user_id, token, impersonator_id, expires_at, created_at
 		FROM sessions
 		WHERE token = ? AND expires_at > CURRENT_TIMESTAMP
 	`
 
 	session := &models.Session{}
-	err := r.db.QueryRow(query, token).Scan(
+	err := r.db.QueryRowContext(ctx, query, token).Scan(
 		&session.ID,
 		&session.UserID,
 		&session.Token,
+		&session.ImpersonatorID,
 		&session.ExpiresAt,
 		&session.CreatedAt,
 	)
@@ -274,28 +420,15 @@ func (r *usersRepository) GetSessionByToken(token string) (*models.Session, erro
 }
 
 // GetUserBySessionToken retrieves a user by their session token
-func (r *usersRepository) GetUserBySessionToken(token string) (*models.User, error) {
+func (r *usersRepository) GetUserBySessionToken(ctx context.Context, token string) (*models.User, error) {
 	query := `
-		SELECT u.id, u.google_id, u.email, u.name, u.given_name, u.family_name, u.picture, u.locale, u.verified_email, u.created_at, u.updated_at
+		SELECT ` + prefixedUserColumns("u") + `
 		FROM users u
 		INNER JOIN sessions s ON u.id = s.user_id
-		WHERE s.token = ? AND s.expires_at > CURRENT_TIMESTAMP
+		WHERE s.token = ? AND s.expires_at > CURRENT_TIMESTAMP AND u.deleted_at IS NULL
 	`
 
-	user := &models.User{}
-	err := r.db.QueryRow(query, token).Scan(
-		&user.ID,
-		&user.GoogleID,
-		&user.Email,
-		&user.Name,
-		&user.GivenName,
-		&user.FamilyName,
-		&user.Picture,
-		&user.Locale,
-		&user.VerifiedEmail,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, token))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -306,11 +439,67 @@ func (r *usersRepository) GetUserBySessionToken(token string) (*models.User, err
 	return user, nil
 }
 
+// ListSessionsByUserID lists the active sessions of a user, newest first
+func (r *usersRepository) ListSessionsByUserID(ctx context.Context, userID int64) ([]*models.Session, error) {
+	query := `
+		SELECT id, user_id, token, impersonator_id, expires_at, created_at
+		FROM sessions
+		WHERE user_id = ? AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		session := &models.Session{}
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.Token,
+			&session.ImpersonatorID,
+			&session.ExpiresAt,
+			&session.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
 // DeleteSession deletes a session by its token
-func (r *usersRepository) DeleteSession(token string) error {
+func (r *usersRepository) DeleteSession(ctx context.Context, token string) error {
 	query := `DELETE FROM sessions WHERE token = ?`
 
-	result, err := r.db.Exec(query, token)
+	result, err := r.db.ExecContext(ctx, query, token)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("session not found")
+	}
+
+	return nil
+}
+
+// DeleteSessionByID revokes a single session of a user
+func (r *usersRepository) DeleteSessionByID(ctx context.Context, id, userID int64) error {
+	query := `DELETE FROM sessions WHERE id = ? AND user_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
 	if err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
@@ -327,11 +516,22 @@ func (r *usersRepository) DeleteSession(token string) error {
 	return nil
 }
 
+// DeleteSessionsByUserID revokes every session of a user
+func (r *usersRepository) DeleteSessionsByUserID(ctx context.Context, userID int64) error {
+	query := `DELETE FROM sessions WHERE user_id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to delete user sessions: %w", err)
+	}
+
+	return nil
+}
+
 // DeleteExpiredSessions removes all expired sessions from the database
-func (r *usersRepository) DeleteExpiredSessions() error {
+func (r *usersRepository) DeleteExpiredSessions(ctx context.Context) error {
 	query := `DELETE FROM sessions WHERE expires_at <= CURRENT_TIMESTAMP`
 
-	_, err := r.db.Exec(query)
+	_, err := r.db.ExecContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to delete expired sessions: %w", err)
 	}
@@ -0,0 +1,283 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/jobs"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/mail"
+)
+
+const (
+	// JobKind is the job kind used to build export archives in the background
+	JobKind = "data_export"
+
+	// Retention is how long a generated archive stays available
+	Retention = 7 * 24 * time.Hour
+)
+
+// jobPayload is the payload of a JobKind job
+type jobPayload struct {
+	ExportID int64 `json:"export_id"`
+}
+
+// Service assembles user data exports
+type Service struct {
+	exports repositories.DataExportsRepository
+	users   repositories.UsersRepository
+	queue   *jobs.Queue
+	mailer  mail.Mailer
+	dir     string
+	baseURL string
+
+	mu        sync.RWMutex
+	exporters []Exporter
+}
+
+// NewService creates an export service storing archives in dir
+func NewService(
+	exports repositories.DataExportsRepository,
+	users repositories.UsersRepository,
+	queue *jobs.Queue,
+	mailer mail.Mailer,
+	dir string,
+	baseURL string,
+) *Service {
+	return &Service{
+		exports: exports,
+		users:   users,
+		queue:   queue,
+		mailer:  mailer,
+		dir:     dir,
+		baseURL: baseURL,
+	}
+}
+
+// Register adds exporters whose output is included in every archive
+func (s *Service) Register(exporters ...Exporter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exporters = append(s.exporters, exporters...)
+}
+
+// Request records a new export for the user and schedules its generation.
+// A pending export is reused and a previous archive is replaced.
+func (s *Service) Request(ctx context.Context, userID int64) (*models.DataExport, error) {
+	latest, err := s.exports.GetLatestDataExportByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && latest.Status == models.DataExportPending {
+		return latest, nil
+	}
+	if latest != nil {
+		s.Delete(ctx, latest)
+	}
+
+	export := &models.DataExport{
+		UserID: userID,
+		Status: models.DataExportPending,
+	}
+	if err := s.exports.CreateDataExport(ctx, export); err != nil {
+		return nil, err
+	}
+
+	if err := s.queue.Enqueue(ctx, JobKind, jobPayload{ExportID: export.ID}); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// Process is the job handler building the archive of a requested export
+func (s *Service) Process(ctx context.Context, payload json.RawMessage) error {
+	var p jobPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	export, err := s.exports.GetDataExportByID(ctx, p.ExportID)
+	if err != nil {
+		return err
+	}
+	if export == nil || export.Status != models.DataExportPending {
+		// Deleted or already processed, nothing to do
+		return nil
+	}
+
+	path, err := s.build(ctx, export)
+	if err != nil {
+		message := err.Error()
+		export.Status = models.DataExportFailed
+		export.Error = &message
+		if updateErr := s.exports.UpdateDataExport(ctx, export); updateErr != nil {
+			logging.From(ctx).Error("failed to mark data export as failed", "error", updateErr, "export_id", export.ID)
+		}
+		return err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(Retention)
+	export.Status = models.DataExportReady
+	export.FilePath = &path
+	export.Error = nil
+	export.CompletedAt = &now
+	export.ExpiresAt = &expiresAt
+	if err := s.exports.UpdateDataExport(ctx, export); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	s.notifyReady(ctx, export)
+	return nil
+}
+
+// Delete removes an export along with its archive
+func (s *Service) Delete(ctx context.Context, export *models.DataExport) {
+	if export.FilePath != nil {
+		if err := os.Remove(*export.FilePath); err != nil && !os.IsNotExist(err) {
+			logging.From(ctx).Error("failed to remove data export archive", "error", err, "export_id", export.ID)
+		}
+	}
+	if err := s.exports.DeleteDataExport(ctx, export.ID); err != nil {
+		logging.From(ctx).Error("failed to delete data export", "error", err, "export_id", export.ID)
+	}
+}
+
+// DeleteExpired removes the exports whose archive is past its retention,
+// it is meant to run periodically from the scheduler
+func (s *Service) DeleteExpired(ctx context.Context) error {
+	exports, err := s.exports.ListExpiredDataExports(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		s.Delete(ctx, export)
+	}
+
+	return nil
+}
+
+// DeleteForUser removes every export of a user, used when the account is purged
+func (s *Service) DeleteForUser(ctx context.Context, userID int64) error {
+	exports, err := s.exports.ListDataExportsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		s.Delete(ctx, export)
+	}
+
+	return nil
+}
+
+// build writes the archive of an export and returns its path
+func (s *Service) build(ctx context.Context, export *models.DataExport) (string, error) {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(s.dir, fmt.Sprintf("export-%d-*.zip", export.ID))
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive: %w", err)
+	}
+	path := file.Name()
+
+	if err := s.write(ctx, file, export.UserID); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to close archive: %w", err)
+	}
+
+	return path, nil
+}
+
+// write streams every exporter output as a JSON file into a zip archive
+func (s *Service) write(ctx context.Context, file *os.File, userID int64) error {
+	s.mu.RLock()
+	exporters := append([]Exporter(nil), s.exporters...)
+	s.mu.RUnlock()
+
+	archive := zip.NewWriter(file)
+	files := make([]string, 0, len(exporters))
+
+	for _, exporter := range exporters {
+		data, err := exporter.Export(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", exporter.Name(), err)
+		}
+
+		name := exporter.Name() + ".json"
+		if err := writeJSON(archive, name, data); err != nil {
+			return err
+		}
+		files = append(files, name)
+	}
+
+	manifest := map[string]any{
+		"user_id":      userID,
+		"generated_at": time.Now().UTC(),
+		"files":        files,
+	}
+	if err := writeJSON(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to finalize archive: %w", err)
+	}
+
+	return nil
+}
+
+// writeJSON adds an indented JSON file to the archive
+func writeJSON(archive *zip.Writer, name string, data any) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// notifyReady emails the user once the archive can be downloaded
+func (s *Service) notifyReady(ctx context.Context, export *models.DataExport) {
+	user, err := s.users.GetUserByID(ctx, export.UserID)
+	if err != nil || user == nil {
+		logging.From(ctx).Error("failed to load user for data export notification", "error", err, "export_id", export.ID)
+		return
+	}
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your data export is ready",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"The export of your data is ready. You can download it from your settings page:\n\n" +
+			s.baseURL + "/settings\n\n" +
+			"The archive will be deleted after 7 days.\n",
+	})
+	if err != nil {
+		logging.From(ctx).Error("failed to send data export notification", "error", err, "export_id", export.ID)
+	}
+}
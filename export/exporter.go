@@ -0,0 +1,86 @@
+package export
+
+import (
+	"context"
+
+	"github.com/hyperstitieux/template/database/repositories"
+)
+
+// Exporter contributes one JSON file to a user's data export.
+// Application features storing personal data register their own exporter
+// on the Service so it ends up in the archive.
+type Exporter interface {
+	// Name is the file name (without extension) inside the archive
+	Name() string
+	// Export returns the JSON-serializable data of the user
+	Export(ctx context.Context, userID int64) (any, error)
+}
+
+type funcExporter struct {
+	name string
+	fn   func(ctx context.Context, userID int64) (any, error)
+}
+
+// Func adapts a function into an Exporter
+func Func(name string, fn func(ctx context.Context, userID int64) (any, error)) Exporter {
+	return &funcExporter{name: name, fn: fn}
+}
+
+func (e *funcExporter) Name() string {
+	return e.name
+}
+
+func (e *funcExporter) Export(ctx context.Context, userID int64) (any, error) {
+	return e.fn(ctx, userID)
+}
+
+// identity describes a sign-in provider linked to the account
+type identity struct {
+	Provider      string `json:"provider"`
+	ProviderID    string `json:"provider_id"`
+	Email         string `json:"email"`
+	VerifiedEmail bool   `json:"verified_email"`
+}
+
+// session describes a session without its secret token
+type session struct {
+	ID        int64  `json:"id"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// UserExporters returns the exporters for the data owned by the users repository
+func UserExporters(users repositories.UsersRepository) []Exporter {
+	return []Exporter{
+		Func("profile", func(ctx context.Context, userID int64) (any, error) {
+			return users.GetUserByID(ctx, userID)
+		}),
+		Func("identities", func(ctx context.Context, userID int64) (any, error) {
+			user, err := users.GetUserByID(ctx, userID)
+			if err != nil || user == nil {
+				return nil, err
+			}
+			return []identity{{
+				Provider:      "google",
+				ProviderID:    user.GoogleID,
+				Email:         user.ProviderEmail,
+				VerifiedEmail: user.VerifiedEmail,
+			}}, nil
+		}),
+		Func("sessions", func(ctx context.Context, userID int64) (any, error) {
+			sessions, err := users.ListSessionsByUserID(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			result := make([]session, 0, len(sessions))
+			for _, s := range sessions {
+				result = append(result, session{
+					ID:        s.ID,
+					CreatedAt: s.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+					ExpiresAt: s.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+				})
+			}
+			return result, nil
+		}),
+	}
+}
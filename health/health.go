@@ -0,0 +1,168 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperstitieux/template/logging"
+)
+
+// checkTimeout bounds each readiness check so a stuck dependency can't hang the probe
+const checkTimeout = 2 * time.Second
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check reports whether a dependency is usable, returning why when it isn't
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of a check in the readiness response. Errors are
+// only logged, they may reveal paths, hosts or queries to anyone reaching the probe.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms,omitempty"`
+}
+
+// Response is the body of the liveness and readiness endpoints
+type Response struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks of the application
+type Checker struct {
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+// New creates a checker without checks, ready until Drain is called
+func New() *Checker {
+	return &Checker{}
+}
+
+// Add registers a readiness check, they all run concurrently on each probe
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Drain reports the application as not ready from now on, so that load
+// balancers stop sending traffic before the server shuts down
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Run runs every check and reports the application ready when they all pass
+func (c *Checker) Run(ctx context.Context) Response {
+	response := Response{Status: StatusOK, Checks: make(map[string]CheckResult, len(c.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := runCheck(ctx, nc)
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Checks[nc.name] = result
+			if result.Status != StatusOK {
+				response.Status = StatusUnavailable
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.draining.Load() {
+		response.Status = StatusUnavailable
+		response.Checks["shutdown"] = CheckResult{Status: StatusUnavailable}
+	}
+	return response
+}
+
+// runCheck runs a check with a timeout, measures its latency and logs why it failed
+func runCheck(ctx context.Context, nc namedCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := nc.check(ctx)
+	result := CheckResult{
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusUnavailable
+		logging.From(ctx).Warn("readiness check failed", "check", nc.name, "error", err)
+	}
+	return result
+}
+
+// ServeHTTP implements the readiness endpoint, answering 503 when not ready
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := c.Run(r.Context())
+
+	status := http.StatusOK
+	if response.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, response)
+}
+
+// Liveness returns the liveness endpoint handler, it only tells the process
+// is able to serve requests and never checks dependencies
+func Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Response{Status: StatusOK})
+	})
+}
+
+// writeJSON writes a probe response, which must never be cached
+func writeJSON(w http.ResponseWriter, status int, response Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Migrations returns a check failing while some embedded migrations aren't
+// applied to the database
+func Migrations(pending func(ctx context.Context) ([]string, error)) Check {
+	return func(ctx context.Context) error {
+		versions, err := pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(versions) > 0 {
+			return fmt.Errorf("%d pending migrations: %s", len(versions), strings.Join(versions, ", "))
+		}
+		return nil
+	}
+}
+
+// JobBacklog returns a check failing when more than max jobs are waiting for a worker
+func JobBacklog(backlog func(ctx context.Context) (int, error), max int) Check {
+	return func(ctx context.Context) error {
+		count, err := backlog(ctx)
+		if err != nil {
+			return err
+		}
+		if count > max {
+			return fmt.Errorf("%d jobs waiting, more than %d", count, max)
+		}
+		return nil
+	}
+}
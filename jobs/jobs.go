@@ -0,0 +1,259 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hyperstitieux/template/logging"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Handler processes the payload of a job, returning an error to retry it later
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Config holds queue tuning options
+type Config struct {
+	Workers      int           // Number of concurrent workers
+	PollInterval time.Duration // Delay between polls when the queue is empty
+	MaxAttempts  int           // Attempts before a job is marked as failed
+	JobTimeout   time.Duration // Maximum duration of a single job run
+}
+
+// DefaultConfig returns sensible defaults for a small application
+func DefaultConfig() Config {
+	return Config{
+		Workers:      2,
+		PollInterval: time.Second,
+		MaxAttempts:  5,
+		JobTimeout:   5 * time.Minute,
+	}
+}
+
+// Queue is a durable job queue backed by the jobs table
+type Queue struct {
+	db       *sql.DB
+	config   Config
+	handlers map[string]Handler
+	mu       sync.RWMutex
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a queue using the given database
+func New(db *sql.DB, cfg Config) *Queue {
+	return &Queue{
+		db:       db,
+		config:   cfg,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Register binds a handler to a job kind
+func (q *Queue) Register(kind string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = handler
+}
+
+// Enqueue schedules a job to run as soon as a worker is available
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any) error {
+	return q.EnqueueAt(ctx, kind, payload, time.Now())
+}
+
+// EnqueueAt schedules a job to run at the given time
+func (q *Queue) EnqueueAt(ctx context.Context, kind string, payload any, runAt time.Time) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	query := `INSERT INTO jobs (kind, payload, run_at) VALUES (?, ?, ?)`
+	if _, err := q.db.ExecContext(ctx, query, kind, string(data), runAt.UTC()); err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	return nil
+}
+
+// Start launches the workers, they run until Stop is called
+func (q *Queue) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+
+	// Jobs left running by a previous process are picked up again
+	if _, err := q.db.Exec(`UPDATE jobs SET status = ? WHERE status = ?`, StatusPending, StatusRunning); err != nil {
+		slog.Error("failed to reset running jobs", "error", err)
+	}
+
+	for i := 0; i < q.config.Workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+
+	slog.Info("job workers started", "workers", q.config.Workers)
+}
+
+// Stop asks the workers to finish their current job and waits for them
+// until ctx is done
+func (q *Queue) Stop(ctx context.Context) error {
+	if q.cancel == nil {
+		return nil
+	}
+	q.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("job workers stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("job workers did not stop in time: %w", ctx.Err())
+	}
+}
+
+// Backlog returns the number of jobs due but not picked up by a worker yet
+func (q *Queue) Backlog(ctx context.Context) (int, error) {
+	var count int
+	err := q.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM jobs WHERE status = ? AND run_at <= ?`,
+		StatusPending, time.Now().UTC(),
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pending jobs: %w", err)
+	}
+	return count, nil
+}
+
+// work processes jobs until ctx is cancelled
+func (q *Queue) work(ctx context.Context) {
+	defer q.wg.Done()
+
+	for {
+		processed, err := q.processNext(ctx)
+		if err != nil {
+			slog.Error("failed to process job", "error", err)
+		}
+		if processed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(q.config.PollInterval):
+		}
+	}
+}
+
+// processNext claims and runs the next due job, reporting whether one was found
+func (q *Queue) processNext(ctx context.Context) (bool, error) {
+	var (
+		id       int64
+		kind     string
+		payload  string
+		attempts int
+	)
+
+	query := `
+		UPDATE jobs
+		SET status = ?, attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = ? AND run_at <= ?
+			ORDER BY run_at
+			LIMIT 1
+		)
+		RETURNING id, kind, payload, attempts
+	`
+	err := q.db.QueryRowContext(ctx, query, StatusRunning, StatusPending, time.Now().UTC()).Scan(&id, &kind, &payload, &attempts)
+	if err == sql.ErrNoRows || ctx.Err() != nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	q.mu.RLock()
+	handler, ok := q.handlers[kind]
+	q.mu.RUnlock()
+
+	if !ok {
+		return true, q.finish(id, StatusFailed, fmt.Errorf("no handler registered for job kind %q", kind), time.Time{})
+	}
+
+	// Jobs run on their own context so that stopping the queue lets them finish
+	jobCtx, cancel := context.WithTimeout(context.Background(), q.config.JobTimeout)
+	defer cancel()
+
+	// Logs written by the handler are tagged with the job
+	logger := slog.Default().With("job_id", id, "job_kind", kind)
+	jobCtx = logging.NewContext(jobCtx, logger)
+
+	start := time.Now()
+	if err := q.run(jobCtx, handler, json.RawMessage(payload)); err != nil {
+		logger.Warn("job failed",
+			"attempt", attempts,
+			"error", err,
+		)
+
+		if attempts >= q.config.MaxAttempts {
+			return true, q.finish(id, StatusFailed, err, time.Time{})
+		}
+
+		// Exponential backoff: 2s, 4s, 8s, ...
+		retryAt := time.Now().Add(time.Duration(1<<attempts) * time.Second)
+		return true, q.finish(id, StatusPending, err, retryAt)
+	}
+
+	logger.Info("job completed", "duration", time.Since(start))
+	return true, q.finish(id, StatusDone, nil, time.Time{})
+}
+
+// run calls the handler, turning panics into errors
+func (q *Queue) run(ctx context.Context, handler Handler, payload json.RawMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, payload)
+}
+
+// finish records the outcome of a job run
+func (q *Queue) finish(id int64, status string, jobErr error, retryAt time.Time) error {
+	var lastError *string
+	if jobErr != nil {
+		message := jobErr.Error()
+		lastError = &message
+	}
+
+	query := `UPDATE jobs SET status = ?, last_error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	args := []any{status, lastError, id}
+	if !retryAt.IsZero() {
+		query = `UPDATE jobs SET status = ?, last_error = ?, run_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+		args = []any{status, lastError, retryAt.UTC(), id}
+	}
+
+	if _, err := q.db.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to update job %d: %w", id, err)
+	}
+
+	return nil
+}
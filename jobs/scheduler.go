@@ -0,0 +1,116 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hyperstitieux/template/logging"
+)
+
+// Task is a unit of periodic work run by the Scheduler
+type Task func(ctx context.Context) error
+
+type scheduledTask struct {
+	name     string
+	interval time.Duration
+	task     Task
+}
+
+// Scheduler runs tasks at a fixed interval, once when started and then
+// every interval, until stopped
+type Scheduler struct {
+	tasks []scheduledTask
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates an empty scheduler
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every registers a task to run every interval, must be called before Start
+func (s *Scheduler) Every(name string, interval time.Duration, task Task) {
+	s.tasks = append(s.tasks, scheduledTask{
+		name:     name,
+		interval: interval,
+		task:     task,
+	})
+}
+
+// Start launches one goroutine per registered task
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, t := range s.tasks {
+		s.wg.Add(1)
+		go s.loop(ctx, t)
+	}
+
+	slog.Info("scheduler started", "tasks", len(s.tasks))
+}
+
+// Stop cancels the running tasks and waits for them until ctx is done
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler did not stop in time: %w", ctx.Err())
+	}
+}
+
+// loop runs a task immediately and then on every tick
+func (s *Scheduler) loop(ctx context.Context, t scheduledTask) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		s.run(ctx, t)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run executes a task once, logging failures and panics
+func (s *Scheduler) run(ctx context.Context, t scheduledTask) {
+	// Logs written by the task are tagged with its name
+	logger := slog.Default().With("task", t.name)
+	ctx = logging.NewContext(ctx, logger)
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("scheduled task panicked", "error", r)
+		}
+	}()
+
+	start := time.Now()
+	if err := t.task(ctx); err != nil {
+		logger.Error("scheduled task failed", "error", err)
+		return
+	}
+	logger.Debug("scheduled task completed", "duration", time.Since(start))
+}
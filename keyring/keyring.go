@@ -0,0 +1,202 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultKeyID identifies the key derived from the secret key when no key ring is configured
+const DefaultKeyID = "default"
+
+// MinKeySize is the minimum size in bytes of a master key
+const MinKeySize = 32
+
+var (
+	// ErrUnknownKey is returned when data was protected with a key no longer in the ring
+	ErrUnknownKey = errors.New("unknown key")
+	// ErrInvalidCiphertext is returned when encrypted data is malformed or tampered with
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+)
+
+// ciphertextPrefix starts every value returned by Encrypt, followed by the key ID
+const ciphertextPrefix = "enc:v1:"
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Key is a master key, its ID is stored along the data it protects so that
+// the key can still be found once it is no longer the primary key
+type Key struct {
+	ID     string
+	secret []byte
+	aead   cipher.AEAD
+}
+
+// Derive returns a subkey of size bytes dedicated to purpose, so that a master
+// key is never used directly by two algorithms
+func (k Key) Derive(purpose string, size int) []byte {
+	subkey, err := hkdf.Key(sha256.New, k.secret, nil, purpose, size)
+	if err != nil {
+		// Only fails for sizes larger than SHA-256 allows
+		panic(err)
+	}
+	return subkey
+}
+
+// CiphertextPrefix returns the prefix of the values encrypted with the key,
+// e.g. to find the data not encrypted with the primary key yet
+func (k Key) CiphertextPrefix() string {
+	return ciphertextPrefix + k.ID + ":"
+}
+
+// Ring holds the master keys. The first key is the primary key, used to
+// encrypt and sign new data; the others only decrypt and verify existing data.
+type Ring struct {
+	keys []Key
+}
+
+// New creates a ring from keys given by ID, the primary key first
+func New(ids []string, secrets [][]byte) (*Ring, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("key ring has no key")
+	}
+
+	ring := &Ring{}
+	for i, id := range ids {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid key ID %q, expected letters, digits, - or _", id)
+		}
+		if _, ok := ring.Lookup(id); ok {
+			return nil, fmt.Errorf("duplicate key ID %q", id)
+		}
+		if len(secrets[i]) < MinKeySize {
+			return nil, fmt.Errorf("key %q is shorter than %d bytes", id, MinKeySize)
+		}
+
+		key := Key{ID: id, secret: secrets[i]}
+		block, err := aes.NewCipher(key.Derive("encryption", 32))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher of key %q: %w", id, err)
+		}
+		if key.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, fmt.Errorf("failed to create cipher of key %q: %w", id, err)
+		}
+		ring.keys = append(ring.keys, key)
+	}
+	return ring, nil
+}
+
+// Parse reads a ring written as comma separated id:key pairs, the primary key
+// first, each key base64 encoded (e.g. generated with openssl rand -base64 32)
+func Parse(s string) (*Ring, error) {
+	var (
+		ids     []string
+		secrets [][]byte
+	)
+	for i, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			// Named by position, the entry may be a key missing its ID
+			return nil, fmt.Errorf("invalid key #%d, expected id:base64", i+1)
+		}
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q, expected base64: %w", id, err)
+		}
+		ids = append(ids, id)
+		secrets = append(secrets, secret)
+	}
+	return New(ids, secrets)
+}
+
+// FromSecret creates a ring holding a single key, DefaultKeyID, derived from
+// a secret of any length (e.g. the secret key of older configurations)
+func FromSecret(secret string) *Ring {
+	master := sha256.Sum256([]byte(secret))
+	ring, err := New([]string{DefaultKeyID}, [][]byte{master[:]})
+	if err != nil {
+		panic(err)
+	}
+	return ring
+}
+
+// Primary returns the key protecting new data
+func (r *Ring) Primary() Key {
+	return r.keys[0]
+}
+
+// Lookup returns the key with the given ID
+func (r *Ring) Lookup(id string) (Key, bool) {
+	for _, key := range r.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// IDs returns the key IDs, the primary key first
+func (r *Ring) IDs() []string {
+	ids := make([]string, len(r.keys))
+	for i, key := range r.keys {
+		ids[i] = key.ID
+	}
+	return ids
+}
+
+// Encrypt encrypts plaintext with the primary key using AES-256-GCM. The
+// result is printable and names the key, see Decrypt.
+func (r *Ring) Encrypt(plaintext []byte) (string, error) {
+	key := r.Primary()
+	nonce := make([]byte, key.aead.NonceSize(), key.aead.NonceSize()+len(plaintext)+key.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := key.aead.Seal(nonce, nonce, plaintext, nil)
+	return key.CiphertextPrefix() + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt with the key it names, which
+// may be any key of the ring
+func (r *Ring) Decrypt(ciphertext string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(ciphertext, ciphertextPrefix)
+	if !ok {
+		return nil, ErrInvalidCiphertext
+	}
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, ErrInvalidCiphertext
+	}
+	key, ok := r.Lookup(id)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < key.aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, sealed := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+	plaintext, err := key.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted reports whether value was returned by Encrypt, telling it apart
+// from values stored before their column was encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, ciphertextPrefix)
+}
@@ -0,0 +1,116 @@
+package keyring
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testKey returns a base64 encoded key of size bytes, all set to b
+func testKey(b byte, size int) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), size)))
+}
+
+func TestDecrypt(t *testing.T) {
+	old, err := Parse("old:" + testKey('o', 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := Parse("new:" + testKey('n', 32) + ",old:" + testKey('o', 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotatedOut, err := Parse("new:" + testKey('n', 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := old.Encrypt([]byte("192.0.2.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Change a character of the sealed data, past the prefix and the nonce and
+	// before the last one, whose low bits may not be decoded
+	tampered := []byte(ciphertext)
+	if i := len(tampered) - 5; tampered[i] == 'A' {
+		tampered[i] = 'B'
+	} else {
+		tampered[i] = 'A'
+	}
+
+	tests := []struct {
+		name       string
+		ring       *Ring
+		ciphertext string
+		err        error
+	}{
+		{name: "round trip", ring: old, ciphertext: ciphertext},
+		{name: "older key of the ring", ring: rotated, ciphertext: ciphertext},
+		{name: "rotated-out key", ring: rotatedOut, ciphertext: ciphertext, err: ErrUnknownKey},
+		{name: "tampered", ring: old, ciphertext: string(tampered), err: ErrInvalidCiphertext},
+		{name: "missing key ID", ring: old, ciphertext: "enc:v1:abc", err: ErrInvalidCiphertext},
+		{name: "not encrypted", ring: old, ciphertext: "192.0.2.1", err: ErrInvalidCiphertext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plaintext, err := tt.ring.Decrypt(tt.ciphertext)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if err == nil && string(plaintext) != "192.0.2.1" {
+				t.Errorf("plaintext = %q, want 192.0.2.1", plaintext)
+			}
+		})
+	}
+}
+
+func TestEncryptUsesPrimaryKey(t *testing.T) {
+	ring, err := Parse("new:" + testKey('n', 32) + ",old:" + testKey('o', 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := ring.Encrypt([]byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ciphertext, "enc:v1:new:") || !IsEncrypted(ciphertext) {
+		t.Errorf("ciphertext %q isn't named after the primary key", ciphertext)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		ids   []string
+		err   string
+	}{
+		{name: "primary first", input: "b:" + testKey('b', 32) + ", a:" + testKey('a', 32), ids: []string{"b", "a"}},
+		{name: "empty", input: "", err: "key ring has no key"},
+		{name: "duplicate ID", input: "a:" + testKey('a', 32) + ",a:" + testKey('b', 32), err: `duplicate key ID "a"`},
+		{name: "short key", input: "a:" + testKey('a', 16), err: `key "a" is shorter than 32 bytes`},
+		{name: "bad base64", input: "a:not base64!", err: `invalid key "a", expected base64`},
+		{name: "invalid ID", input: "a b:" + testKey('a', 32), err: `invalid key ID "a b"`},
+		{name: "missing ID", input: "a:" + testKey('a', 32) + "," + testKey('b', 32), err: "invalid key #2, expected id:base64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring, err := Parse(tt.input)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := strings.Join(ring.IDs(), ","); got != strings.Join(tt.ids, ",") {
+				t.Errorf("IDs = %v, want %v", ring.IDs(), tt.ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config holds the level and format of the application logs
+type Config struct {
+	Level  string `toml:"level" yaml:"level"`   // debug, info, warn or error
+	Format string `toml:"format" yaml:"format"` // FormatText or FormatJSON
+}
+
+// New creates a logger writing to w as configured
+func New(cfg Config, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch cfg.Format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected %s or %s", cfg.Format, FormatText, FormatJSON)
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying logger. The logger is shared by the
+// contexts derived from it, so attributes added with With are visible to
+// middleware that run before the handler adding them.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	holder := &atomic.Pointer[slog.Logger]{}
+	holder.Store(logger)
+	return context.WithValue(ctx, contextKey{}, holder)
+}
+
+// From returns the logger of ctx, the default logger outside of requests and jobs
+func From(ctx context.Context) *slog.Logger {
+	if holder, ok := ctx.Value(contextKey{}).(*atomic.Pointer[slog.Logger]); ok {
+		return holder.Load()
+	}
+	return slog.Default()
+}
+
+// With adds attributes to the logger of ctx (e.g. the user ID once authenticated),
+// it does nothing when ctx has no logger
+func With(ctx context.Context, args ...any) {
+	holder, ok := ctx.Value(contextKey{}).(*atomic.Pointer[slog.Logger])
+	if !ok {
+		return
+	}
+	for {
+		logger := holder.Load()
+		if holder.CompareAndSwap(logger, logger.With(args...)) {
+			return
+		}
+	}
+}
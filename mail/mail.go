@@ -0,0 +1,90 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/logging"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config holds the SMTP settings used to build a Mailer
+type Config struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// New returns an SMTP mailer when a host is configured,
+// otherwise a mailer that only logs messages (useful in development)
+func New(cfg Config) (Mailer, error) {
+	if cfg.Host == "" {
+		return &logMailer{}, nil
+	}
+	from, err := netmail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", cfg.From, err)
+	}
+	return &smtpMailer{config: cfg, from: from}, nil
+}
+
+type smtpMailer struct {
+	config Config
+	from   *netmail.Address // The envelope takes the bare address, the From header the full form
+}
+
+// Send delivers the message through the configured SMTP server
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	addr := net.JoinHostPort(m.config.Host, m.config.Port)
+
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+
+	headers := []string{
+		"From: " + m.from.String(),
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	body := strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(msg.Body, "\n", "\r\n")
+
+	if err := smtp.SendMail(addr, auth, m.from.Address, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
+type logMailer struct{}
+
+// Send logs the message instead of delivering it
+func (m *logMailer) Send(ctx context.Context, msg Message) error {
+	logging.From(ctx).Info("email not sent (no SMTP host configured)",
+		"to", msg.To,
+		"subject", msg.Subject,
+		"body", msg.Body,
+	)
+	return nil
+}
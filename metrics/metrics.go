@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Config tells where metrics are served: on their own listener when Addr is
+// set, otherwise on the main one behind Token. Without either they aren't served.
+type Config struct {
+	Addr  string
+	Token string
+}
+
+// Enabled reports whether metrics are served at all
+func (c Config) Enabled() bool {
+	return c.Addr != "" || c.Token != ""
+}
+
+// Registry holds the metrics exposed by Handler, along with the Go runtime and process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts the requests by route template, not raw path, to keep the cardinality bounded
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	HTTPRequestSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_size_bytes",
+		Help:    "Size of HTTP request bodies, by method and route template.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+	}, []string{"method", "route"})
+
+	HTTPResponseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_response_size_bytes",
+		Help:    "Size of HTTP response bodies, by method and route template.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+	}, []string{"method", "route"})
+
+	HTTPInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being handled.",
+	})
+
+	// RateLimited counts rejected requests by limit, the path prefix of the rule or "default"
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_rate_limited_total",
+		Help: "HTTP requests rejected by a rate limit.",
+	}, []string{"limit"})
+
+	// SignIns counts sign in attempts, reason is the audit reason of failures
+	SignIns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_sign_ins_total",
+		Help: "Sign in attempts, by result (success or failure) and failure reason.",
+	}, []string{"result", "reason"})
+
+	HotReloadClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hotreload_clients",
+		Help: "Browsers connected to the hot reload WebSocket.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		HTTPRequestSize,
+		HTTPResponseSize,
+		HTTPInFlight,
+		RateLimited,
+		SignIns,
+		HotReloadClients,
+	)
+}
+
+// RegisterDB exposes the connection pool statistics of db
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus text format. When token isn't
+// empty, scrapers must send it as a bearer token.
+func Handler(token string) http.Handler {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
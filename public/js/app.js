@@ -1,68 +1,3 @@
-// =============================================================================
-// Hot Reload Client (Development Only)
-// =============================================================================
-(function() {
-  'use strict';
-
-  // Only run in development
-  if (window.location.hostname !== 'localhost' && window.location.hostname !== '127.0.0.1') {
-    return;
-  }
-
-  let ws;
-  let reconnectAttempts = 0;
-  const maxReconnectAttempts = 10;
-  const reconnectDelay = 1000;
-
-  function connect() {
-    const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    const wsUrl = `${protocol}//${window.location.host}/__hotreload`;
-
-    console.log('[Hot Reload] Connecting to', wsUrl);
-
-    ws = new WebSocket(wsUrl);
-
-    ws.onopen = function() {
-      console.log('[Hot Reload] Connected');
-      reconnectAttempts = 0;
-    };
-
-    ws.onmessage = function(event) {
-      if (event.data === 'reload') {
-        console.log('[Hot Reload] Reloading page...');
-        window.location.reload();
-      }
-    };
-
-    ws.onerror = function(error) {
-      console.error('[Hot Reload] WebSocket error:', error);
-    };
-
-    ws.onclose = function() {
-      console.log('[Hot Reload] Disconnected');
-
-      // Attempt to reconnect
-      if (reconnectAttempts < maxReconnectAttempts) {
-        reconnectAttempts++;
-        console.log(`[Hot Reload] Reconnecting... (attempt ${reconnectAttempts}/${maxReconnectAttempts})`);
-        setTimeout(connect, reconnectDelay);
-      } else {
-        console.log('[Hot Reload] Max reconnection attempts reached. Please refresh manually.');
-      }
-    };
-  }
-
-  // Start connection
-  connect();
-
-  // Cleanup on page unload
-  window.addEventListener('beforeunload', function() {
-    if (ws) {
-      ws.close();
-    }
-  });
-})();
-
 // =============================================================================
 // Banner Date/Time Display
 // =============================================================================
@@ -0,0 +1,122 @@
+// =============================================================================
+// Hot Reload Client (Development Only)
+// =============================================================================
+(function() {
+  'use strict';
+
+  // Only run in development
+  if (window.location.hostname !== 'localhost' && window.location.hostname !== '127.0.0.1') {
+    return;
+  }
+
+  let ws;
+  let overlay;
+  let reconnectAttempts = 0;
+  const maxReconnectAttempts = 10;
+  const reconnectDelay = 1000;
+
+  // Shows the output of a failed build over the page until the next build
+  function showBuildError(output) {
+    if (!overlay) {
+      overlay = document.createElement('div');
+      overlay.id = 'hotreload-overlay';
+      overlay.style.cssText = 'position:fixed;inset:0;z-index:2147483647;overflow:auto;padding:2rem;' +
+        'background:rgba(10,10,10,0.92);color:#fafafa;font:14px/1.5 ui-monospace,SFMono-Regular,Menlo,monospace;';
+
+      const header = document.createElement('div');
+      header.style.cssText = 'display:flex;justify-content:space-between;align-items:center;margin-bottom:1rem;';
+
+      const title = document.createElement('strong');
+      title.style.cssText = 'color:#f87171;font-size:16px;';
+      title.textContent = 'Build failed';
+
+      const close = document.createElement('button');
+      close.type = 'button';
+      close.textContent = 'Dismiss';
+      close.style.cssText = 'color:inherit;background:none;border:1px solid #525252;border-radius:4px;padding:2px 10px;cursor:pointer;';
+      close.addEventListener('click', hideBuildError);
+
+      const pre = document.createElement('pre');
+      pre.style.cssText = 'white-space:pre-wrap;margin:0;';
+
+      header.append(title, close);
+      overlay.append(header, pre);
+    }
+
+    overlay.querySelector('pre').textContent = output;
+    document.body.appendChild(overlay);
+  }
+
+  function hideBuildError() {
+    if (overlay) {
+      overlay.remove();
+    }
+  }
+
+  function connect() {
+    const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+    const wsUrl = `${protocol}//${window.location.host}/__hotreload`;
+
+    console.log('[Hot Reload] Connecting to', wsUrl);
+
+    ws = new WebSocket(wsUrl);
+
+    ws.onopen = function() {
+      console.log('[Hot Reload] Connected');
+
+      // The server restarted after a successful build
+      if (overlay && overlay.isConnected) {
+        window.location.reload();
+        return;
+      }
+      reconnectAttempts = 0;
+    };
+
+    ws.onmessage = function(event) {
+      if (event.data === 'reload') {
+        console.log('[Hot Reload] Reloading page...');
+        window.location.reload();
+        return;
+      }
+
+      let message;
+      try {
+        message = JSON.parse(event.data);
+      } catch (error) {
+        return;
+      }
+
+      if (message.type === 'build_error') {
+        console.error('[Hot Reload] Build failed:\n' + message.output);
+        showBuildError(message.output);
+      }
+    };
+
+    ws.onerror = function(error) {
+      console.error('[Hot Reload] WebSocket error:', error);
+    };
+
+    ws.onclose = function() {
+      console.log('[Hot Reload] Disconnected');
+
+      // Attempt to reconnect
+      if (reconnectAttempts < maxReconnectAttempts) {
+        reconnectAttempts++;
+        console.log(`[Hot Reload] Reconnecting... (attempt ${reconnectAttempts}/${maxReconnectAttempts})`);
+        setTimeout(connect, reconnectDelay);
+      } else {
+        console.log('[Hot Reload] Max reconnection attempts reached. Please refresh manually.');
+      }
+    };
+  }
+
+  // Start connection
+  connect();
+
+  // Cleanup on page unload
+  window.addEventListener('beforeunload', function() {
+    if (ws) {
+      ws.close();
+    }
+  });
+})();
@@ -0,0 +1,219 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// sourceContext is the number of lines shown around the line of a stack frame
+const sourceContext = 5
+
+// PanicError is the error of a recovered panic, with the stack it was raised from
+type PanicError struct {
+	Value any
+	Stack []byte    // Formatted stack, as printed in logs
+	pcs   []uintptr // Program counters of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the value passed to panic when it's an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// newPanicError captures the stack of a panic, it must be called from the deferred function
+func newPanicError(value any, stack []byte) *PanicError {
+	// A panic re-raised by another middleware keeps its original stack
+	if err, ok := value.(*PanicError); ok {
+		return err
+	}
+
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	return &PanicError{Value: value, Stack: stack, pcs: pcs[:n]}
+}
+
+// DebugInfo describes a failed request for the development error page
+type DebugInfo struct {
+	Status    int
+	Error     error
+	Chain     []string // Messages of the error and the errors it wraps
+	Panic     bool
+	Stack     []StackFrame
+	Method    string
+	URL       string
+	Proto     string
+	ClientIP  string
+	RequestID string
+	Headers   []Header
+}
+
+// StackFrame is a function call of a panic stack
+type StackFrame struct {
+	Function string
+	File     string
+	Line     int
+	App      bool // Whether the file belongs to the application rather than Go or a dependency
+	Source   []SourceLine
+}
+
+// SourceLine is a line of source code around a stack frame
+type SourceLine struct {
+	Number  int
+	Text    string
+	Current bool
+}
+
+// Header is a request header, with sensitive values redacted
+type Header struct {
+	Name  string
+	Value string
+}
+
+// DebugRenderer renders the development error page of a request
+type DebugRenderer func(w http.ResponseWriter, r *http.Request, info *DebugInfo) error
+
+// debugRenderer replaces the error page of server errors in development, set with SetDebugRenderer
+var debugRenderer DebugRenderer
+
+// SetDebugRenderer sets how server errors are shown to browsers in development,
+// the regular error page is rendered until it is set. It must never be set in
+// production as the page exposes source code and headers.
+func SetDebugRenderer(renderer DebugRenderer) {
+	debugRenderer = renderer
+}
+
+// redactedHeaders are the request headers whose value isn't shown on the debug page
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+}
+
+// newDebugInfo collects what the development error page shows about a failed request
+func newDebugInfo(r *http.Request, status int, err error) *DebugInfo {
+	info := &DebugInfo{
+		Status:    status,
+		Error:     err,
+		Chain:     errorChain(err),
+		Method:    r.Method,
+		URL:       r.URL.String(),
+		Proto:     r.Proto,
+		ClientIP:  ClientIP(r),
+		RequestID: r.Header.Get("X-Request-ID"),
+	}
+
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		info.Panic = true
+		info.Stack = stackFrames(panicErr.pcs)
+	}
+
+	for name, values := range r.Header {
+		value := strings.Join(values, ", ")
+		if redactedHeaders[name] {
+			value = "[redacted]"
+		}
+		info.Headers = append(info.Headers, Header{Name: name, Value: value})
+	}
+	sort.Slice(info.Headers, func(i, j int) bool {
+		return info.Headers[i].Name < info.Headers[j].Name
+	})
+
+	return info
+}
+
+// errorChain returns the messages of err and of the errors it wraps, in order
+func errorChain(err error) []string {
+	var chain []string
+	for err != nil {
+		chain = append(chain, err.Error())
+
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		case interface{ Unwrap() []error }:
+			// Joined errors are listed after their parent
+			for _, wrapped := range e.Unwrap() {
+				chain = append(chain, errorChain(wrapped)...)
+			}
+			return chain
+		default:
+			return chain
+		}
+	}
+	return chain
+}
+
+// stackFrames resolves program counters to frames, starting at the function that panicked
+func stackFrames(pcs []uintptr) []StackFrame {
+	var stack []StackFrame
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+
+		// Frames until runtime.gopanic belong to the recovery itself
+		if frame.Function == "runtime.gopanic" {
+			stack = stack[:0]
+		} else {
+			stack = append(stack, StackFrame{
+				Function: frame.Function,
+				File:     frame.File,
+				Line:     frame.Line,
+				App:      isAppFile(frame.File),
+			})
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	// Source is only read for the application's own code
+	for i := range stack {
+		if stack[i].App {
+			stack[i].Source = sourceLines(stack[i].File, stack[i].Line)
+		}
+	}
+	return stack
+}
+
+// isAppFile reports whether a file is part of the application source tree
+func isAppFile(file string) bool {
+	wd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(file, wd+string(os.PathSeparator)) && !strings.Contains(file, "/vendor/")
+}
+
+// sourceLines reads the lines around line in file, nil when the file can't be read
+func sourceLines(file string, line int) []SourceLine {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+
+	lines := strings.Split(string(data), "\n")
+	start := max(line-sourceContext, 1)
+	end := min(line+sourceContext, len(lines))
+
+	var source []SourceLine
+	for n := start; n <= end; n++ {
+		source = append(source, SourceLine{
+			Number:  n,
+			Text:    lines[n-1],
+			Current: n == line,
+		})
+	}
+	return source
+}
@@ -2,8 +2,12 @@ package router
 
 import (
 	"encoding/json"
-	"log/slog"
+	"errors"
 	"net/http"
+	"strings"
+
+	"github.com/hyperstitieux/template/logging"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // HTTPError represents an HTTP error with a status code and message
@@ -48,59 +52,104 @@ var (
 // HandlerFunc is a custom handler type that can return errors
 type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
 
+// ErrorRenderer renders an error as an HTML page, with err.Code as status
+type ErrorRenderer func(w http.ResponseWriter, r *http.Request, err *HTTPError) error
+
+// errorRenderer renders the errors of requests accepting HTML, set with SetErrorRenderer
+var errorRenderer ErrorRenderer
+
+// SetErrorRenderer sets how errors are rendered for browsers, JSON is used otherwise
+func SetErrorRenderer(renderer ErrorRenderer) {
+	errorRenderer = renderer
+}
+
 // Handle wraps a HandlerFunc to handle errors automatically
 func Handle(h HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := h(w, r); err != nil {
-			handleError(w, r, err)
+			WriteError(w, r, err)
 		}
 	}
 }
 
-// handleError handles errors returned by handlers
-func handleError(w http.ResponseWriter, r *http.Request, err error) {
-	requestID := r.Header.Get("X-Request-ID")
-
-	// Check if it's an HTTPError
-	if httpErr, ok := err.(*HTTPError); ok {
-		// Log the error with context
-		if httpErr.Code >= 500 {
-			slog.Error("internal server error",
-				"error", httpErr.Message,
-				"details", httpErr.Details,
-				"path", r.URL.Path,
-				"method", r.Method,
-				"request_id", requestID,
-			)
-		} else {
-			slog.Warn("client error",
-				"error", httpErr.Message,
-				"code", httpErr.Code,
-				"details", httpErr.Details,
-				"path", r.URL.Path,
-				"method", r.Method,
-				"request_id", requestID,
-			)
-		}
+// errorHandler responds to every request with err
+func errorHandler(err *HTTPError) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, err)
+	})
+}
+
+// WriteError logs an error and writes it as an HTML page or JSON depending on
+// the Accept header. Errors other than HTTPError are sent as 500 without details.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	logger := logging.From(r.Context())
+
+	var panicErr *PanicError
+	httpErr, ok := err.(*HTTPError)
+	switch {
+	case errors.As(err, &panicErr):
+		// Already logged with its stack by the recovery middleware
+		httpErr = ErrInternalServer
+	case !ok:
+		// Unknown error - log and return 500
+		logger.Error("unexpected error",
+			"error", err.Error(),
+			"path", r.URL.Path,
+			"method", r.Method,
+		)
+		httpErr = ErrInternalServer
+	case httpErr.Code >= 500:
+		logger.Error("internal server error",
+			"error", httpErr.Message,
+			"details", httpErr.Details,
+			"path", r.URL.Path,
+			"method", r.Method,
+		)
+	default:
+		logger.Warn("client error",
+			"error", httpErr.Message,
+			"code", httpErr.Code,
+			"details", httpErr.Details,
+			"path", r.URL.Path,
+			"method", r.Method,
+		)
+	}
 
-		// Write error response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(httpErr.Code)
-		json.NewEncoder(w).Encode(httpErr)
+	// The server span, if any, carries the cause of server errors
+	if httpErr.Code >= 500 {
+		trace.SpanFromContext(r.Context()).RecordError(err)
+	}
+
+	// Developers get the details of server errors instead of the error page
+	if debugRenderer != nil && httpErr.Code >= 500 && acceptsHTML(r) {
+		if err := debugRenderer(w, r, newDebugInfo(r, httpErr.Code, err)); err != nil {
+			logger.Error("failed to render debug page", "error", err)
+		}
 		return
 	}
 
-	// Unknown error - log and return 500
-	slog.Error("unexpected error",
-		"error", err.Error(),
-		"path", r.URL.Path,
-		"method", r.Method,
-		"request_id", requestID,
-	)
+	if errorRenderer != nil && acceptsHTML(r) {
+		if err := errorRenderer(w, r, httpErr); err != nil {
+			logger.Error("failed to render error page", "error", err)
+		}
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusInternalServerError)
-	json.NewEncoder(w).Encode(map[string]string{
-		"error": "internal server error",
-	})
+	w.WriteHeader(httpErr.Code)
+	json.NewEncoder(w).Encode(httpErr)
+}
+
+// acceptsHTML reports whether the client prefers HTML over JSON, as browsers do
+func acceptsHTML(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(accepted), ";")
+		switch mediaType {
+		case "text/html", "application/xhtml+xml":
+			return true
+		case "application/json":
+			return false
+		}
+	}
+	return false
 }
@@ -12,6 +12,8 @@ type Router struct {
 	*mux.Router
 	config       Config
 	hotReloadMux *mux.Router
+	openapi      *openAPIRegistry
+	middlewares  []mux.MiddlewareFunc
 }
 
 // WrapRouter wraps a mux.Router to add helper methods
@@ -19,6 +21,47 @@ func WrapRouter(r *mux.Router) *Router {
 	return &Router{Router: r}
 }
 
+// Use appends middlewares to the router, they run for every matching route
+func (r *Router) Use(middlewares ...mux.MiddlewareFunc) {
+	r.middlewares = append(r.middlewares, middlewares...)
+	r.Router.Use(middlewares...)
+}
+
+// fallback responds with err to the requests matching no route. mux skips
+// middlewares for them, so they're applied here to log, secure and
+// authenticate these requests like any other.
+func (r *Router) fallback(err *HTTPError) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handler := errorHandler(err)
+		for i := len(r.middlewares) - 1; i >= 0; i-- {
+			handler = r.middlewares[i].Middleware(handler)
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// Group creates a subrouter for the routes under prefix, with the same helpers.
+// The middlewares only run for the routes of the group, after the global ones.
+func (r *Router) Group(prefix string, middlewares ...func(http.Handler) http.Handler) *Router {
+	sub := r.PathPrefix(prefix).Subrouter()
+	for _, middleware := range middlewares {
+		sub.Use(middleware)
+	}
+	return &Router{Router: sub, config: r.config, openapi: r.registry()}
+}
+
+// Route creates a group under prefix and lets fn register its routes and middlewares:
+//
+//	r.Route("/admin", func(admin *router.Router) {
+//		admin.Use(auth.RequireRoleMiddleware(models.RoleAdmin))
+//		admin.Get("", adminController.Users)
+//	})
+func (r *Router) Route(prefix string, fn func(g *Router)) *Router {
+	g := r.Group(prefix)
+	fn(g)
+	return g
+}
+
 // Get registers a GET route with automatic error handling
 func (r *Router) Get(path string, handler HandlerFunc) *mux.Route {
 	return r.HandleFunc(path, Handle(handler)).Methods(http.MethodGet)
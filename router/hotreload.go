@@ -1,12 +1,19 @@
 package router
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/metrics"
 )
 
 var (
@@ -17,13 +24,36 @@ var (
 	}
 	clients      = make(map[*websocket.Conn]bool)
 	clientsMutex sync.RWMutex
+
+	// lastBuildError is sent to clients connecting while the build is broken
+	lastBuildError string
+
+	// hotReload adds the hot reload script to pages, set with SetHotReload
+	hotReload bool
 )
 
+// SetHotReload enables the hot reload script in pages and the reload triggers,
+// only in development as the script connects back to the server for its lifetime
+func SetHotReload(enabled bool) {
+	hotReload = enabled
+}
+
+// HotReloadEnabled reports whether pages include the hot reload script
+func HotReloadEnabled() bool {
+	return hotReload
+}
+
+// buildErrorMessage is sent to clients when the application fails to build
+type buildErrorMessage struct {
+	Type   string `json:"type"`
+	Output string `json:"output"`
+}
+
 // HotReloadHandler handles WebSocket connections for hot reload
 func HotReloadHandler(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		slog.Error("failed to upgrade websocket connection", "error", err)
+		logging.From(r.Context()).Error("failed to upgrade websocket connection", "error", err)
 		return
 	}
 	defer conn.Close()
@@ -31,16 +61,25 @@ func HotReloadHandler(w http.ResponseWriter, r *http.Request) {
 	// Register client
 	clientsMutex.Lock()
 	clients[conn] = true
+	metrics.HotReloadClients.Inc()
+	if lastBuildError != "" {
+		if err := conn.WriteJSON(buildErrorMessage{Type: "build_error", Output: lastBuildError}); err != nil {
+			logging.From(r.Context()).Error("failed to send build error", "error", err)
+		}
+	}
 	clientsMutex.Unlock()
 
-	slog.Debug("hot reload client connected", "remote_addr", r.RemoteAddr)
+	logging.From(r.Context()).Debug("hot reload client connected", "remote_addr", r.RemoteAddr)
 
 	// Keep connection alive and handle disconnect
 	defer func() {
 		clientsMutex.Lock()
-		delete(clients, conn)
+		if clients[conn] {
+			delete(clients, conn)
+			metrics.HotReloadClients.Dec()
+		}
 		clientsMutex.Unlock()
-		slog.Debug("hot reload client disconnected", "remote_addr", r.RemoteAddr)
+		logging.From(r.Context()).Debug("hot reload client disconnected", "remote_addr", r.RemoteAddr)
 	}()
 
 	// Read messages (mainly to detect disconnect)
@@ -67,18 +106,126 @@ func NotifyReload() {
 	}
 }
 
-// StartReloadWatcher watches for reload signal file
-func StartReloadWatcher() {
+// NotifyBuildError sends the output of a failed build to all connected clients,
+// which show it in an overlay until the next successful build reloads the page
+func NotifyBuildError(output string) {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+
+	lastBuildError = output
+	slog.Warn("notifying clients of a build error", "count", len(clients))
+
+	for conn := range clients {
+		err := conn.WriteJSON(buildErrorMessage{Type: "build_error", Output: output})
+		if err != nil {
+			slog.Error("failed to send build error", "error", err)
+		}
+	}
+}
+
+// CloseHotReloadClients closes the WebSocket connections on shutdown, they
+// aren't tracked by http.Server once upgraded
+func CloseHotReloadClients(ctx context.Context) error {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Second)
+	}
+
+	for conn := range clients {
+		conn.WriteControl(websocket.CloseMessage, message, deadline)
+		conn.Close()
+		delete(clients, conn)
+		metrics.HotReloadClients.Dec()
+	}
+	return nil
+}
+
+// StartReloadWatcher watches the build error log written by Air and pushes new
+// build errors to the clients. Air keeps the previous binary running when a build
+// fails, this is how the browser learns about it. The returned function stops it.
+func StartReloadWatcher(logPath string) func(ctx context.Context) error {
+	// Errors logged before this process started are from older builds
+	var offset int64
+	if info, err := os.Stat(logPath); err == nil {
+		offset = info.Size()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
 	go func() {
-		// This will be triggered by Air's post_cmd
-		// For now, it's a placeholder that could watch a signal file
-		slog.Debug("hot reload watcher started")
+		defer close(done)
+		slog.Debug("hot reload watcher started", "path", logPath)
+
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(logPath)
+			if err != nil {
+				continue
+			}
+
+			// The log is appended to, only the new output is sent
+			size := info.Size()
+			if size < offset {
+				offset = 0
+			}
+			if size == offset {
+				continue
+			}
+
+			output, err := readFrom(logPath, offset)
+			if err != nil {
+				slog.Error("failed to read build error log", "error", err)
+				continue
+			}
+			offset = size
+
+			if output = strings.TrimSpace(output); output != "" {
+				NotifyBuildError(output)
+			}
+		}
 	}()
+
+	return func(stopCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return fmt.Errorf("hot reload watcher did not stop in time: %w", stopCtx.Err())
+		}
+	}
+}
+
+// readFrom reads a file from offset to its end
+func readFrom(path string, offset int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(f)
+	return string(data), err
 }
 
-// TriggerReloadIfDev triggers a reload if in development mode
+// TriggerReloadIfDev triggers a reload if hot reload is enabled
 func TriggerReloadIfDev() {
-	if os.Getenv("GO_ENV") != "production" {
+	if HotReloadEnabled() {
 		NotifyReload()
 	}
 }
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadWatcher(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "build-errors.log")
+	if err := os.WriteFile(logPath, []byte("older build error\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		clientsMutex.Lock()
+		lastBuildError = ""
+		clientsMutex.Unlock()
+	})
+
+	stop := StartReloadWatcher(logPath)
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("main.go:1: syntax error\n")
+	f.Close()
+
+	// The watcher polls the log twice a second
+	var got string
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		clientsMutex.RLock()
+		got = lastBuildError
+		clientsMutex.RUnlock()
+		if got != "" {
+			break
+		}
+	}
+	if got != "main.go:1: syntax error" {
+		t.Errorf("build error = %q, want only the new output", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+}
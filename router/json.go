@@ -0,0 +1,257 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+)
+
+// MaxBodySize is the largest request body accepted by JSON handlers
+const MaxBodySize = 1 << 20
+
+// Validatable is implemented by request types declaring their validation rules.
+// Fields are validated by their JSON name, with their value formatted as a string.
+type Validatable interface {
+	Rules() *validator.Validator
+}
+
+// StatusCoder is implemented by response types that aren't sent with 200 OK
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// NoContent is a response without body, sent with 204 No Content
+type NoContent struct{}
+
+// JSON wraps a typed handler: the request is bound from the query string (GET,
+// HEAD, DELETE) or the JSON/form body, validated, and the response encoded as JSON.
+//
+//	r.Patch("/api/me", router.JSON(apiController.UpdateMe))
+func JSON[Req, Res any](fn func(ctx context.Context, req Req) (Res, error)) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		var req Req
+		if err := bind(w, r, &req); err != nil {
+			return err
+		}
+
+		if rules := requestRules(&req); rules != nil {
+			if ok, errs := rules.ValidateData(fieldValues(req)); !ok {
+				return NewHTTPError(ErrUnprocessableEntity.Code, ErrUnprocessableEntity.Message).WithDetails(errs)
+			}
+		}
+
+		res, err := fn(r.Context(), req)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := any(res).(NoContent); ok {
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+
+		status := http.StatusOK
+		if s, ok := any(res).(StatusCoder); ok {
+			status = s.StatusCode()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		return json.NewEncoder(w).Encode(res)
+	}
+}
+
+// bind decodes the request into dst
+func bind(w http.ResponseWriter, r *http.Request, dst any) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		return bindValues(r.URL.Query(), dst)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodySize)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+			return bindError(err)
+		}
+		return nil
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		if err := r.ParseMultipartForm(MaxBodySize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return bindError(err)
+		}
+		return bindValues(r.Form, dst)
+	case "":
+		// Requests without body (POST actions) are bound from the query string
+		if r.ContentLength == 0 {
+			return bindValues(r.URL.Query(), dst)
+		}
+	}
+
+	return NewHTTPError(http.StatusUnsupportedMediaType, "unsupported content type")
+}
+
+// bindError converts a decoding error to the HTTP error sent to the client
+func bindError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return NewHTTPError(http.StatusRequestEntityTooLarge, "request body too large")
+	}
+	return NewHTTPError(http.StatusBadRequest, "invalid request body").WithDetails(err.Error())
+}
+
+// bindValues sets the fields of the struct pointed to by dst from form values,
+// matched by their JSON name
+func bindValues(values url.Values, dst any) error {
+	v := reflect.ValueOf(dst).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := fieldName(field)
+		if name == "" {
+			continue
+		}
+
+		raw, ok := values[name]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		if err := setValue(v.Field(i), raw); err != nil {
+			return NewHTTPError(http.StatusBadRequest, "invalid request parameter").WithDetails(
+				map[string]string{name: err.Error()},
+			)
+		}
+	}
+	return nil
+}
+
+// setValue parses raw into a field of a basic type, a pointer to one or a slice of strings
+func setValue(field reflect.Value, raw []string) error {
+	if field.Kind() == reflect.Pointer {
+		value := reflect.New(field.Type().Elem())
+		if err := setValue(value.Elem(), raw); err != nil {
+			return err
+		}
+		field.Set(value)
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw[0])
+	case reflect.Bool:
+		// Checkboxes are sent as "on"
+		b, err := strconv.ParseBool(raw[0])
+		if err != nil && raw[0] != "on" {
+			return fmt.Errorf("expected a boolean")
+		}
+		field.SetBool(b || raw[0] == "on")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw[0], 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an integer")
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw[0], 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected a positive integer")
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw[0], field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected a number")
+		}
+		field.SetFloat(n)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", field.Type())
+		}
+		field.Set(reflect.ValueOf(append([]string(nil), raw...)))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// requestRules returns the validation rules of a request, whether Rules has a
+// value or a pointer receiver, nil when it has none
+func requestRules[Req any](req *Req) *validator.Validator {
+	if v, ok := any(*req).(Validatable); ok {
+		return v.Rules()
+	}
+	if v, ok := any(req).(Validatable); ok {
+		return v.Rules()
+	}
+	return nil
+}
+
+// fieldValues formats the fields of a request struct for libvalidator, by JSON name.
+// Zero values, nil pointers and empty slices are validated as empty strings, so
+// that 0 and false don't pass Required: a pointer tells them apart from a missing value.
+func fieldValues(req any) map[string]string {
+	data := map[string]string{}
+
+	v := reflect.Indirect(reflect.ValueOf(req))
+	if v.Kind() != reflect.Struct {
+		return data
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		name := fieldName(v.Type().Field(i))
+		if name == "" {
+			continue
+		}
+
+		value := v.Field(i)
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		} else if value.IsZero() {
+			continue
+		}
+
+		switch {
+		case value.Kind() == reflect.Slice:
+			items := make([]string, value.Len())
+			for j := range items {
+				items[j] = fmt.Sprint(value.Index(j).Interface())
+			}
+			data[name] = strings.Join(items, ",")
+		default:
+			data[name] = fmt.Sprint(value.Interface())
+		}
+	}
+	return data
+}
+
+// fieldName returns the JSON name of an exported struct field, empty when ignored
+func fieldName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+)
+
+// pointerRulesRequest declares its rules on a pointer receiver
+type pointerRulesRequest struct {
+	Name string `json:"name"`
+}
+
+func (r *pointerRulesRequest) Rules() *validator.Validator {
+	return validator.New(validator.Field("name").Required())
+}
+
+// zeroValuesRequest requires fields whose zero value is a valid JSON value
+type zeroValuesRequest struct {
+	Quantity int      `json:"quantity"`
+	Accepted bool     `json:"accepted"`
+	Priority *int     `json:"priority"`
+	Tags     []string `json:"tags"`
+}
+
+func (zeroValuesRequest) Rules() *validator.Validator {
+	return validator.New(
+		validator.Field("quantity").Required(),
+		validator.Field("accepted").Required(),
+		validator.Field("priority").Required(),
+		validator.Field("tags").Required(),
+	)
+}
+
+func TestJSONValidation(t *testing.T) {
+	pointerRules := JSON(func(ctx context.Context, req pointerRulesRequest) (NoContent, error) {
+		return NoContent{}, nil
+	})
+	zeroValues := JSON(func(ctx context.Context, req zeroValuesRequest) (NoContent, error) {
+		return NoContent{}, nil
+	})
+
+	tests := []struct {
+		name    string
+		handler HandlerFunc
+		body    string
+		invalid []string // Fields reported as invalid, none when the request is valid
+	}{
+		{name: "pointer receiver rules", handler: pointerRules, body: `{}`, invalid: []string{"name"}},
+		{name: "pointer receiver rules satisfied", handler: pointerRules, body: `{"name":"Ann"}`},
+		{name: "zero values are missing", handler: zeroValues, body: `{"quantity":0,"accepted":false,"tags":[]}`, invalid: []string{"quantity", "accepted", "priority", "tags"}},
+		{name: "pointer to zero is set", handler: zeroValues, body: `{"quantity":1,"accepted":true,"priority":0,"tags":["a"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			err := tt.handler(rec, req)
+
+			if len(tt.invalid) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			httpErr, ok := err.(*HTTPError)
+			if !ok || httpErr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("error = %v, want 422", err)
+			}
+			errs, _ := httpErr.Details.(validator.ValidationErrors)
+			for _, field := range tt.invalid {
+				if _, ok := errs[field]; !ok {
+					t.Errorf("%s isn't reported invalid: %v", field, errs)
+				}
+			}
+		})
+	}
+}
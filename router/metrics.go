@@ -0,0 +1,75 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/metrics"
+)
+
+// metricsMiddleware records the request metrics, labelled by route template so
+// that /admin/users/1 and /admin/users/2 are aggregated together
+func metricsMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			metrics.HTTPInFlight.Inc()
+			defer metrics.HTTPInFlight.Dec()
+
+			mrw := &metricsResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(mrw, r)
+
+			route := routeTemplate(r)
+			metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(mrw.statusCode)).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+			metrics.HTTPResponseSize.WithLabelValues(r.Method, route).Observe(float64(mrw.size))
+			if r.ContentLength >= 0 {
+				metrics.HTTPRequestSize.WithLabelValues(r.Method, route).Observe(float64(r.ContentLength))
+			}
+		})
+	}
+}
+
+// routeTemplate returns the path template of the matched route, "unmatched" for
+// requests answered by the not found and method not allowed handlers
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+		if template, err := route.GetPathRegexp(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+// metricsResponseWriter wraps http.ResponseWriter to capture the status code and body size
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	size        int
+	wroteHeader bool
+}
+
+func (mrw *metricsResponseWriter) WriteHeader(code int) {
+	if !mrw.wroteHeader {
+		mrw.statusCode = code
+		mrw.wroteHeader = true
+	}
+	mrw.ResponseWriter.WriteHeader(code)
+}
+
+func (mrw *metricsResponseWriter) Write(p []byte) (int, error) {
+	mrw.wroteHeader = true
+	n, err := mrw.ResponseWriter.Write(p)
+	mrw.size += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (mrw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mrw.ResponseWriter
+}
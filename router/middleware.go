@@ -1,12 +1,18 @@
 package router
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hyperstitieux/template/accesslog"
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // requestIDMiddleware adds a unique request ID to each request
@@ -14,6 +20,10 @@ func requestIDMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			requestID := r.Header.Get("X-Request-ID")
+			if requestID == "" {
+				// Reuse the trace ID when traced, so logs and traces share the same ID
+				requestID = tracing.TraceID(r.Context())
+			}
 			if requestID == "" {
 				requestID = uuid.New().String()
 			}
@@ -26,58 +36,134 @@ func requestIDMiddleware() func(http.Handler) http.Handler {
 	}
 }
 
-// structuredLoggerMiddleware logs requests using slog (structured logging)
-func structuredLoggerMiddleware() func(http.Handler) http.Handler {
+// contextLoggerMiddleware places a logger describing the request in its context,
+// retrieved with logging.From
+func contextLoggerMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger := slog.Default().With(
+				"request_id", r.Header.Get("X-Request-ID"),
+				"route", routeTemplate(r),
+				"ip", ClientIP(r),
+			)
+			// Logs of traced requests can be found from the trace and the other way around
+			if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+				logger = logger.With("trace_id", span.TraceID().String(), "span_id", span.SpanID().String())
+			}
+
+			next.ServeHTTP(w, r.WithContext(logging.NewContext(r.Context(), logger)))
+		})
+	}
+}
+
+// structuredLoggerMiddleware logs requests to the access log when configured,
+// using slog (structured logging) otherwise
+func structuredLoggerMiddleware(accessLog *accesslog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 
-			// Wrap ResponseWriter to capture status code
+			// Wrap ResponseWriter to capture status code and size
 			lrw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
-			next.ServeHTTP(lrw, r)
+			// Filled by the authentication middleware, which runs after this one and
+			// possibly still runs in the goroutine of the timeout middleware
+			userID := &atomic.Pointer[string]{}
+			ctx := context.WithValue(r.Context(), accessLogUserContextKey, userID)
+
+			next.ServeHTTP(lrw, r.WithContext(ctx))
 
 			duration := time.Since(start)
 
-			slog.Info("http request",
+			if accessLog != nil {
+				var user string
+				if id := userID.Load(); id != nil {
+					user = *id
+				}
+				accessLog.Log(accesslog.Entry{
+					Time:      start,
+					Method:    r.Method,
+					URI:       r.URL.RequestURI(),
+					Proto:     r.Proto,
+					Route:     routeTemplate(r),
+					Status:    lrw.statusCode,
+					Bytes:     lrw.size,
+					Duration:  duration,
+					IP:        ClientIP(r),
+					Referrer:  r.Referer(),
+					UserAgent: r.UserAgent(),
+					RequestID: r.Header.Get("X-Request-ID"),
+					UserID:    user,
+				})
+				return
+			}
+
+			logging.From(r.Context()).Info("http request",
 				"method", r.Method,
 				"path", r.URL.Path,
 				"status", lrw.statusCode,
+				"bytes", lrw.size,
 				"duration", duration,
-				"ip", r.RemoteAddr,
+				"referrer", r.Referer(),
 				"user_agent", r.UserAgent(),
-				"request_id", r.Header.Get("X-Request-ID"),
 			)
 		})
 	}
 }
 
-// loggingResponseWriter wraps http.ResponseWriter to capture the status code
+// accessLogUserContextKey holds the user ID written to the access log
+const accessLogUserContextKey contextKey = "access_log_user"
+
+// SetAccessLogUser records the user who made the request in the access log
+func SetAccessLogUser(r *http.Request, userID string) {
+	if user, ok := r.Context().Value(accessLogUserContextKey).(*atomic.Pointer[string]); ok {
+		user.Store(&userID)
+	}
+}
+
+// loggingResponseWriter wraps http.ResponseWriter to capture the status code and body size
 type loggingResponseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode  int
+	size        int64
+	wroteHeader bool
 }
 
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
-	lrw.statusCode = code
+	if !lrw.wroteHeader {
+		lrw.statusCode = code
+		lrw.wroteHeader = true
+	}
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+func (lrw *loggingResponseWriter) Write(p []byte) (int, error) {
+	lrw.wroteHeader = true
+	n, err := lrw.ResponseWriter.Write(p)
+	lrw.size += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
 // recoveryMiddleware recovers from panics and logs them
 func recoveryMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if err := recover(); err != nil {
-					slog.Error("panic recovered",
-						"error", err,
+					panicErr := newPanicError(err, debug.Stack())
+					logging.From(r.Context()).Error("panic recovered",
+						"error", panicErr.Value,
 						"path", r.URL.Path,
 						"method", r.Method,
-						"request_id", r.Header.Get("X-Request-ID"),
-						"stack", string(debug.Stack()),
+						"stack", string(panicErr.Stack),
 					)
 
-					http.Error(w, `{"error": "internal server error"}`, http.StatusInternalServerError)
+					WriteError(w, r, panicErr)
 				}
 			}()
 
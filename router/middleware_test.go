@@ -0,0 +1,58 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperstitieux/template/accesslog"
+)
+
+func TestAccessLogUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		late     bool // The user is set by a handler that outlives the timeout
+		wantUser bool
+	}{
+		{name: "set in time", wantUser: true},
+		{name: "set after the timeout", late: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "access.log")
+			accessLog, err := accesslog.New(accesslog.Config{Path: path, Format: accesslog.FormatJSON})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			release, set := make(chan struct{}), make(chan struct{})
+			handler := structuredLoggerMiddleware(accessLog)(timeoutMiddleware(20*time.Millisecond, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.late {
+					<-release
+				}
+				SetAccessLogUser(r, "42")
+				close(set)
+			})))
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			close(release)
+			<-set
+			if err := accessLog.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(string(data), `"user_id":"42"`); got != tt.wantUser {
+				t.Errorf("user logged = %v, want %v: %s", got, tt.wantUser, data)
+			}
+		})
+	}
+}
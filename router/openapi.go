@@ -0,0 +1,446 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/gorilla/mux"
+)
+
+// OpenAPIInfo describes the API in the OpenAPI document
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIDocument is an OpenAPI 3.1 document
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+// OpenAPIComponents holds the schemas referenced by operations
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// OpenAPIOperation is an operation of a path
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter is a path or query parameter
+type OpenAPIParameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// OpenAPIRequestBody is the body accepted by an operation
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse is a response of an operation
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType is the schema of a body for a content type
+type OpenAPIMediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is a JSON Schema, as used by OpenAPI 3.1
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"` // A type name, or a list of them for nullable types
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// jsonOperation is a typed JSON route registered with HandleJSON
+type jsonOperation struct {
+	route   *mux.Route
+	method  string
+	summary string
+	req     reflect.Type
+	res     reflect.Type
+}
+
+// openAPIRegistry collects the typed routes of a router and its groups
+type openAPIRegistry struct {
+	mu         sync.Mutex
+	operations []*jsonOperation
+}
+
+// HandleJSON registers a typed JSON route (see JSON) documented in the OpenAPI document:
+//
+//	router.HandleJSON(api, http.MethodGet, "/me", "Profile of the signed in user", apiController.Me)
+func HandleJSON[Req, Res any](r *Router, method, path, summary string, fn func(ctx context.Context, req Req) (Res, error)) *mux.Route {
+	route := r.HandleFunc(path, Handle(JSON(fn))).Methods(method)
+
+	r.registry().mu.Lock()
+	defer r.registry().mu.Unlock()
+	r.registry().operations = append(r.registry().operations, &jsonOperation{
+		route:   route,
+		method:  method,
+		summary: summary,
+		req:     reflect.TypeFor[Req](),
+		res:     reflect.TypeFor[Res](),
+	})
+	return route
+}
+
+// registry returns the typed routes registry shared by the router and its groups
+func (r *Router) registry() *openAPIRegistry {
+	if r.openapi == nil {
+		r.openapi = &openAPIRegistry{}
+	}
+	return r.openapi
+}
+
+// OpenAPI builds the OpenAPI document of the typed routes registered so far
+func (r *Router) OpenAPI(info OpenAPIInfo) (*OpenAPIDocument, error) {
+	r.registry().mu.Lock()
+	defer r.registry().mu.Unlock()
+
+	doc := &OpenAPIDocument{
+		OpenAPI:    "3.1.0",
+		Info:       info,
+		Paths:      map[string]map[string]*OpenAPIOperation{},
+		Components: OpenAPIComponents{Schemas: map[string]*Schema{}},
+	}
+	doc.Components.Schemas["Error"] = &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{"error": {Type: "string"}, "details": {}},
+		Required:   []string{"error"},
+	}
+
+	for _, op := range r.registry().operations {
+		template, err := op.route.GetPathTemplate()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get path of %s route: %w", op.method, err)
+		}
+
+		path, params := openAPIPath(template)
+		operation := &OpenAPIOperation{
+			OperationID: op.route.GetName(),
+			Summary:     op.summary,
+			Parameters:  params,
+			Responses:   map[string]*OpenAPIResponse{},
+		}
+
+		// Requests without a body are bound from the query string
+		if op.req.Kind() == reflect.Struct && op.req.NumField() > 0 {
+			schema := doc.requestSchema(op.req)
+			switch op.method {
+			case http.MethodGet, http.MethodHead, http.MethodDelete:
+				operation.Parameters = append(operation.Parameters, queryParameters(doc.Resolve(schema))...)
+			default:
+				operation.RequestBody = &OpenAPIRequestBody{
+					Required: true,
+					Content: map[string]*OpenAPIMediaType{
+						"application/json":                  {Schema: schema},
+						"application/x-www-form-urlencoded": {Schema: schema},
+					},
+				}
+			}
+			operation.Responses["400"] = errorResponse("Invalid request")
+			if typeRules(op.req) != nil {
+				operation.Responses["422"] = errorResponse("Validation failed, details by field")
+			}
+		}
+
+		status, response := doc.successResponse(op.res)
+		operation.Responses[status] = response
+		operation.Responses["default"] = errorResponse("Error")
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*OpenAPIOperation{}
+		}
+		doc.Paths[path][strings.ToLower(op.method)] = operation
+	}
+
+	return doc, nil
+}
+
+// OpenAPIHandler serves the OpenAPI document
+func OpenAPIHandler(doc *OpenAPIDocument) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(doc)
+	}
+}
+
+// Resolve returns the schema a $ref points to, or the schema itself
+func (doc *OpenAPIDocument) Resolve(schema *Schema) *Schema {
+	if schema == nil || schema.Ref == "" {
+		return schema
+	}
+	return doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+}
+
+// successResponse documents the response of a handler returning res
+func (doc *OpenAPIDocument) successResponse(res reflect.Type) (string, *OpenAPIResponse) {
+	if res == reflect.TypeFor[NoContent]() {
+		return "204", &OpenAPIResponse{Description: "No content"}
+	}
+
+	status := http.StatusOK
+	if res.Implements(reflect.TypeFor[StatusCoder]()) {
+		status = zeroValue(res).Interface().(StatusCoder).StatusCode()
+	}
+	return fmt.Sprint(status), &OpenAPIResponse{
+		Description: http.StatusText(status),
+		Content: map[string]*OpenAPIMediaType{
+			"application/json": {Schema: doc.schema(res, nil)},
+		},
+	}
+}
+
+// requestSchema documents a request type, with the constraints of its validation rules
+func (doc *OpenAPIDocument) requestSchema(req reflect.Type) *Schema {
+	return doc.schema(req, typeRules(req))
+}
+
+// typeRules returns the validation rules of a request type, declared with a
+// value or a pointer receiver like JSON handlers look them up, nil without
+func typeRules(t reflect.Type) *validator.Validator {
+	switch {
+	case t.Implements(reflect.TypeFor[Validatable]()):
+		return zeroValue(t).Interface().(Validatable).Rules()
+	case reflect.PointerTo(t).Implements(reflect.TypeFor[Validatable]()):
+		return reflect.New(t).Interface().(Validatable).Rules()
+	}
+	return nil
+}
+
+// zeroValue returns the zero value of t, pointing to one when t is a pointer so
+// that methods reading fields can be called on it
+func zeroValue(t reflect.Type) reflect.Value {
+	if t.Kind() == reflect.Pointer {
+		return reflect.New(t.Elem())
+	}
+	return reflect.Zero(t)
+}
+
+// schema documents a Go type, named structs are added to the components
+func (doc *OpenAPIDocument) schema(t reflect.Type, rules *validator.Validator) *Schema {
+	if t.Kind() == reflect.Pointer {
+		schema := doc.schema(t.Elem(), rules)
+		if schema.Ref != "" || schema.Type == nil {
+			return schema
+		}
+		return &Schema{Type: []any{schema.Type, "null"}, Format: schema.Format, Items: schema.Items}
+	}
+
+	switch {
+	case t == reflect.TypeFor[time.Time]():
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Implements(reflect.TypeFor[json.Marshaler]()):
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: doc.schema(t.Elem(), nil)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: doc.schema(t.Elem(), nil)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return doc.structSchema(t, rules)
+		}
+		if _, ok := doc.Components.Schemas[t.Name()]; !ok {
+			// Registered before recursing so self-referencing types terminate
+			doc.Components.Schemas[t.Name()] = &Schema{}
+			*doc.Components.Schemas[t.Name()] = *doc.structSchema(t, rules)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	return &Schema{}
+}
+
+// structSchema documents the JSON fields of a struct. Without validation rules, fields
+// without omitempty are required, otherwise the Required rules decide.
+func (doc *OpenAPIDocument) structSchema(t reflect.Type, rules *validator.Validator) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := fieldName(field)
+		if name == "" {
+			continue
+		}
+
+		property := doc.schema(field.Type, nil)
+		if rules != nil {
+			required := applyRules(property, rules, name)
+			if required {
+				schema.Required = append(schema.Required, name)
+			}
+		} else if field.Type.Kind() != reflect.Pointer && !strings.Contains(field.Tag.Get("json"), ",omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+var (
+	minLengthMessage = regexp.MustCompile(`at least (\d+) character`)
+	maxLengthMessage = regexp.MustCompile(`not exceed (\d+) character`)
+)
+
+// applyRules adds the constraints of the validation rules of field to its schema,
+// and reports whether it's required. libvalidator rules are opaque, so they're
+// probed with sample values and recognized by their error messages.
+func applyRules(schema *Schema, rules *validator.Validator, field string) bool {
+	probe := func(value string) []string {
+		_, errs := rules.ValidateData(map[string]string{field: value})
+		return errs.GetAll(field)
+	}
+
+	required := false
+	for _, message := range probe("") {
+		if message == "This field is required" {
+			required = true
+		}
+		if m := minLengthMessage.FindStringSubmatch(message); m != nil {
+			var n int
+			fmt.Sscan(m[1], &n)
+			schema.MinLength = &n
+		}
+	}
+	for _, message := range probe(strings.Repeat("a", 1<<16)) {
+		if m := maxLengthMessage.FindStringSubmatch(message); m != nil {
+			var n int
+			fmt.Sscan(m[1], &n)
+			schema.MaxLength = &n
+		}
+	}
+	for _, message := range probe("!") {
+		switch message {
+		case "Please enter a valid email address":
+			schema.Format = "email"
+		case "Please enter a valid URL":
+			schema.Format = "uri"
+		case "This field must contain only numbers":
+			schema.Pattern = "^[0-9]+$"
+		case "This field must contain only letters":
+			schema.Pattern = "^[a-zA-Z]+$"
+		}
+	}
+	return required
+}
+
+// openAPIPath converts a mux path template to an OpenAPI path and its parameters
+func openAPIPath(template string) (string, []*OpenAPIParameter) {
+	var params []*OpenAPIParameter
+	var path strings.Builder
+
+	for {
+		start := strings.Index(template, "{")
+		if start < 0 {
+			path.WriteString(template)
+			break
+		}
+
+		// Variables may contain braces in their pattern, find the matching one
+		end, depth := -1, 0
+		for i := start; i < len(template); i++ {
+			switch template[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+			if depth == 0 {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			path.WriteString(template)
+			break
+		}
+
+		name, pattern, _ := strings.Cut(template[start+1:end], ":")
+		param := &OpenAPIParameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}}
+		if pattern != "" {
+			param.Schema.Pattern = "^" + pattern + "$"
+		}
+		params = append(params, param)
+
+		path.WriteString(template[:start] + "{" + name + "}")
+		template = template[end+1:]
+	}
+
+	return path.String(), params
+}
+
+// queryParameters documents the fields of a request bound from the query string
+func queryParameters(schema *Schema) []*OpenAPIParameter {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := make([]*OpenAPIParameter, 0, len(names))
+	for _, name := range names {
+		params = append(params, &OpenAPIParameter{
+			Name:     name,
+			In:       "query",
+			Required: slices.Contains(schema.Required, name),
+			Schema:   schema.Properties[name],
+		})
+	}
+	return params
+}
+
+// errorResponse documents an error response
+func errorResponse(description string) *OpenAPIResponse {
+	return &OpenAPIResponse{
+		Description: description,
+		Content: map[string]*OpenAPIMediaType{
+			"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}},
+		},
+	}
+}
@@ -0,0 +1,46 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// createdResponse declares its status on a pointer receiver reading a field
+type createdResponse struct {
+	Queued bool `json:"queued"`
+}
+
+func (r *createdResponse) StatusCode() int {
+	if r.Queued {
+		return http.StatusAccepted
+	}
+	return http.StatusCreated
+}
+
+func TestOpenAPIPointerMethods(t *testing.T) {
+	r := New(Config{})
+	HandleJSON(r, http.MethodPost, "/items", "Create an item", func(ctx context.Context, req pointerRulesRequest) (*createdResponse, error) {
+		return &createdResponse{}, nil
+	})
+
+	doc, err := r.OpenAPI(OpenAPIInfo{Title: "test", Version: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	operation := doc.Paths["/items"]["post"]
+	if operation == nil {
+		t.Fatalf("operation isn't documented: %v", doc.Paths)
+	}
+	if operation.Responses["201"] == nil {
+		t.Errorf("status of the pointer receiver isn't documented: %v", operation.Responses)
+	}
+	if operation.Responses["422"] == nil {
+		t.Errorf("validation of the pointer receiver rules isn't documented: %v", operation.Responses)
+	}
+	schema := doc.Resolve(operation.RequestBody.Content["application/json"].Schema)
+	if len(schema.Required) != 1 || schema.Required[0] != "name" {
+		t.Errorf("required fields = %v, want [name]", schema.Required)
+	}
+}
@@ -0,0 +1,223 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// contextKey is a custom type for context keys to avoid collisions
+type contextKey string
+
+// clientIPContextKey is the key used to store the resolved client IP in the request context
+const clientIPContextKey contextKey = "client_ip"
+
+// ParseTrustedProxies parses a list of CIDRs or single IP addresses
+func ParseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// ClientIP returns the IP address of the client that made the request, as resolved
+// from the trusted proxies headers, or the address of the peer otherwise
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// IsHTTPS reports whether the client reached the application over HTTPS,
+// directly or through a trusted proxy terminating TLS
+func IsHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.URL.Scheme == "https"
+}
+
+// proxyMiddleware resolves the client IP, scheme and host of requests. Forwarding
+// headers are only honored when sent by one of the trusted proxies.
+func proxyMiddleware(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(ip string) bool {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, prefix := range trusted {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hop := forwardedHop{ip: remoteIP(r)}
+			if r.TLS != nil {
+				hop.proto = "https"
+			}
+
+			if isTrusted(hop.ip) {
+				hop = resolveForwarded(r, hop, isTrusted)
+			}
+
+			// Rewrite the request so handlers see the URL the client used
+			if hop.proto == "https" || hop.proto == "http" {
+				r.URL.Scheme = hop.proto
+			} else {
+				r.URL.Scheme = "http"
+			}
+			if hop.host != "" {
+				r.Host = hop.host
+			}
+			r.URL.Host = r.Host
+
+			ctx := context.WithValue(r.Context(), clientIPContextKey, hop.ip)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// forwardedHop is a client or proxy seen along the way of a request
+type forwardedHop struct {
+	ip    string
+	proto string
+	host  string
+}
+
+// resolveForwarded walks the forwarding headers from the closest hop, skipping
+// trusted proxies, and returns the first untrusted hop (the client)
+func resolveForwarded(r *http.Request, peer forwardedHop, isTrusted func(string) bool) forwardedHop {
+	if hops := parseForwarded(r.Header.Values("Forwarded")); len(hops) > 0 {
+		return closestUntrusted(hops, peer, isTrusted)
+	}
+
+	hops := parseXForwardedFor(r)
+	if len(hops) == 0 {
+		return peer
+	}
+
+	// X-Forwarded-Proto and X-Forwarded-Host are set by the proxy facing the client
+	client := closestUntrusted(hops, peer, isTrusted)
+	if proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ","); strings.TrimSpace(proto) != "" {
+		client.proto = strings.ToLower(strings.TrimSpace(proto))
+	}
+	if host, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ","); strings.TrimSpace(host) != "" {
+		client.host = strings.TrimSpace(host)
+	}
+	return client
+}
+
+// closestUntrusted returns the last hop that isn't a trusted proxy, hops that
+// don't specify a proto or host inherit them from the next hop
+func closestUntrusted(hops []forwardedHop, peer forwardedHop, isTrusted func(string) bool) forwardedHop {
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := hops[i]
+		if _, err := netip.ParseAddr(hop.ip); err != nil {
+			// Obfuscated or unknown hops can't be followed further
+			break
+		}
+		if hop.proto == "" {
+			hop.proto = client.proto
+		}
+		if hop.host == "" {
+			hop.host = client.host
+		}
+		client = hop
+		if !isTrusted(hop.ip) {
+			break
+		}
+	}
+	return client
+}
+
+// parseForwarded parses RFC 7239 Forwarded headers, one hop per element. The proto
+// and host parameters describe the request received by the proxy from that hop.
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var hop forwardedHop
+			for _, pair := range strings.Split(element, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				switch strings.ToLower(name) {
+				case "for":
+					hop.ip = forwardedNodeIP(value)
+				case "proto":
+					hop.proto = strings.ToLower(value)
+				case "host":
+					hop.host = value
+				}
+			}
+			if hop.ip != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// forwardedNodeIP extracts the IP of a Forwarded node ("192.0.2.1:80", "[2001:db8::1]:80")
+func forwardedNodeIP(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			return node[1:end]
+		}
+		return node
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return node
+}
+
+// parseXForwardedFor parses the de facto X-Forwarded-For header, falling back to X-Real-IP
+func parseXForwardedFor(r *http.Request) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(value, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				hops = append(hops, forwardedHop{ip: forwardedNodeIP(ip)})
+			}
+		}
+	}
+	if len(hops) == 0 {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			hops = append(hops, forwardedHop{ip: ip})
+		}
+	}
+	return hops
+}
+
+// remoteIP returns the IP of the peer connected to the server
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,168 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyMiddleware(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		ip         string
+		scheme     string
+		host       string
+	}{
+		{
+			name:       "untrusted peer",
+			remoteAddr: "203.0.113.7:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example"},
+			ip:         "203.0.113.7",
+			scheme:     "http",
+			host:       "app.example",
+		},
+		{
+			name:       "untrusted peer with Forwarded",
+			remoteAddr: "203.0.113.7:1234",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.1;proto=https"},
+			ip:         "203.0.113.7",
+			scheme:     "http",
+			host:       "app.example",
+		},
+		{
+			name:       "spoofed left-most X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7"},
+			ip:         "203.0.113.7",
+			scheme:     "http",
+			host:       "app.example",
+		},
+		{
+			name:       "multiple proxy hops",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For":   "198.51.100.1, 203.0.113.7, 192.168.1.1, 10.0.0.2",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "www.example",
+			},
+			ip:     "203.0.113.7",
+			scheme: "https",
+			host:   "www.example",
+		},
+		{
+			name:       "only trusted hops",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			ip:         "10.0.0.3",
+			scheme:     "http",
+			host:       "app.example",
+		},
+		{
+			name:       "X-Real-IP",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Real-IP": "203.0.113.7"},
+			ip:         "203.0.113.7",
+			scheme:     "http",
+			host:       "app.example",
+		},
+		{
+			name:       "Forwarded IPv6 with port",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": `for="[::1]:80";proto=https;host=www.example`},
+			ip:         "::1",
+			scheme:     "https",
+			host:       "www.example",
+		},
+		{
+			name:       "Forwarded multiple hops",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": `for=198.51.100.1, for="203.0.113.7:4711";proto=https, for=10.0.0.2`},
+			ip:         "203.0.113.7",
+			scheme:     "https",
+			host:       "app.example",
+		},
+		{
+			name:       "Forwarded takes precedence",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": "for=203.0.113.7", "X-Forwarded-For": "198.51.100.1"},
+			ip:         "203.0.113.7",
+			scheme:     "http",
+			host:       "app.example",
+		},
+		{
+			name:       "obfuscated hop",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.1, for=_hidden"},
+			ip:         "10.0.0.1",
+			scheme:     "http",
+			host:       "app.example",
+		},
+		{
+			name:       "IPv4-mapped trusted peer",
+			remoteAddr: "[::ffff:10.0.0.1]:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7"},
+			ip:         "203.0.113.7",
+			scheme:     "http",
+			host:       "app.example",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ip, scheme, host string
+			handler := proxyMiddleware(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ip, scheme, host = ClientIP(r), r.URL.Scheme, r.Host
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "http://app.example/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if ip != tt.ip || scheme != tt.scheme || host != tt.host {
+				t.Errorf("got %s %s://%s, want %s %s://%s", ip, scheme, host, tt.ip, tt.scheme, tt.host)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+		err    bool
+	}{
+		{name: "CIDR", values: []string{"10.0.0.1/8"}, want: []string{"10.0.0.0/8"}},
+		{name: "single address", values: []string{"192.168.1.1", "::1"}, want: []string{"192.168.1.1/32", "::1/128"}},
+		{name: "IPv4-mapped address", values: []string{"::ffff:10.0.0.1"}, want: []string{"10.0.0.1/32"}},
+		{name: "invalid address", values: []string{"proxy.local"}, err: true},
+		{name: "invalid CIDR", values: []string{"10.0.0.0/33"}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefixes, err := ParseTrustedProxies(tt.values)
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if len(prefixes) != len(tt.want) {
+				t.Fatalf("prefixes = %v, want %v", prefixes, tt.want)
+			}
+			for i, prefix := range prefixes {
+				if prefix.String() != tt.want[i] {
+					t.Errorf("prefix %d = %s, want %s", i, prefix, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package router
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperstitieux/template/logging"
+	"github.com/hyperstitieux/template/metrics"
+	"golang.org/x/time/rate"
+)
+
+// Limit allows Requests per Period, with bursts of up to Burst requests
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int // Defaults to Requests
+}
+
+// burst returns the bucket size of the limit
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// rate returns the refill rate of the limit in tokens per second
+func (l Limit) rate() rate.Limit {
+	return rate.Limit(float64(l.Requests) / l.Period.Seconds())
+}
+
+// RateLimitRule overrides the limit of the requests whose path starts with PathPrefix
+type RateLimitRule struct {
+	PathPrefix string
+	Limit      Limit
+}
+
+// RateLimitResult describes the state of a bucket after taking a request from it
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // Time until the bucket is full again
+	RetryAfter time.Duration // Time until the next request is allowed, when rejected
+}
+
+// RateLimitStore keeps the buckets of every client. Implement it on top of a
+// shared store (Redis, database...) to enforce limits across instances.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit Limit) (RateLimitResult, error)
+}
+
+// KeyFunc identifies the client a request is counted against, empty when unknown
+type KeyFunc func(r *http.Request) string
+
+// RateLimitConfig configures the RateLimit middleware
+type RateLimitConfig struct {
+	Limit Limit           // Default limit
+	Rules []RateLimitRule // Per route overrides, the first matching rule wins
+	Key   KeyFunc         // Defaults to the API token, then the client IP
+	Store RateLimitStore  // Defaults to an in-memory store
+	Name  string          // Label of the default limit in metrics, rules use their path prefix
+}
+
+// RateLimit creates a middleware limiting the requests of each key separately,
+// each client by default
+func RateLimit(cfg RateLimitConfig) func(http.Handler) http.Handler {
+	if cfg.Key == nil {
+		cfg.Key = KeyFirst(KeyByAPIToken, KeyByIP)
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryRateLimitStore(10000, time.Hour)
+	}
+	if cfg.Name == "" {
+		cfg.Name = "default"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Buckets are namespaced by rule so strict routes don't drain the default one
+			scope, limit := "*", cfg.Limit
+			for _, rule := range cfg.Rules {
+				if strings.HasPrefix(r.URL.Path, rule.PathPrefix) {
+					scope, limit = rule.PathPrefix, rule.Limit
+					break
+				}
+			}
+			if limit.Requests <= 0 || limit.Period <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := cfg.Key(r)
+			if key == "" {
+				key = "anonymous"
+			}
+
+			result, err := cfg.Store.Take(r.Context(), scope+"|"+key, limit)
+			if err != nil {
+				// Fail open, an unavailable store shouldn't take the site down
+				logging.From(r.Context()).Error("rate limit store failed", "error", err, "path", r.URL.Path)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+
+			if !result.Allowed {
+				label := cfg.Name
+				if scope != "*" {
+					label = scope
+				}
+				metrics.RateLimited.WithLabelValues(label).Inc()
+
+				w.Header().Set("Retry-After", strconv.Itoa(max(seconds(result.RetryAfter), 1)))
+				WriteError(w, r, NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds a duration up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// KeyFirst combines key functions, using the first one that identifies the client
+func KeyFirst(keys ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		for _, key := range keys {
+			if k := key(r); k != "" {
+				return k
+			}
+		}
+		return ""
+	}
+}
+
+// KeyAll counts the requests of all clients together
+func KeyAll(r *http.Request) string {
+	return "all"
+}
+
+// KeyByIP identifies clients by their IP address
+func KeyByIP(r *http.Request) string {
+	return "ip:" + ClientIP(r)
+}
+
+// apiTokenContextKey is the key used to store the authenticated API token in the request context
+const apiTokenContextKey contextKey = "api_token"
+
+// SetAPIToken records the API token the request was authenticated with, to be
+// called by the API authentication once the token is verified and before the
+// rate limit middleware. tokenID identifies the token without being secret.
+func SetAPIToken(r *http.Request, tokenID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiTokenContextKey, tokenID))
+}
+
+// KeyByAPIToken identifies clients by the API token they authenticated with,
+// see SetAPIToken. Unverified Authorization headers are ignored, otherwise
+// sending a random token with each request would get a fresh bucket each time.
+func KeyByAPIToken(r *http.Request) string {
+	tokenID, _ := r.Context().Value(apiTokenContextKey).(string)
+	if tokenID == "" {
+		return ""
+	}
+	return "token:" + tokenID
+}
+
+// memoryRateLimitStore keeps token buckets in memory, evicting the least recently
+// used ones beyond maxKeys and the ones idle for longer than ttl
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	maxKeys int
+	ttl     time.Duration
+	order   *list.List // Most recently used first
+	buckets map[string]*list.Element
+	now     func() time.Time
+}
+
+type memoryBucket struct {
+	key      string
+	limit    Limit
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewMemoryRateLimitStore creates a store local to this process
+func NewMemoryRateLimitStore(maxKeys int, ttl time.Duration) RateLimitStore {
+	return &memoryRateLimitStore{
+		maxKeys: maxKeys,
+		ttl:     ttl,
+		order:   list.New(),
+		buckets: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Take consumes a token from the bucket of key
+func (s *memoryRateLimitStore) Take(_ context.Context, key string, limit Limit) (RateLimitResult, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evict(now)
+
+	var bucket *memoryBucket
+	if element, ok := s.buckets[key]; ok {
+		bucket = element.Value.(*memoryBucket)
+		s.order.MoveToFront(element)
+	} else {
+		// Make room by dropping the least recently used bucket
+		if s.order.Len() >= s.maxKeys {
+			oldest := s.order.Back()
+			s.order.Remove(oldest)
+			delete(s.buckets, oldest.Value.(*memoryBucket).key)
+		}
+		bucket = &memoryBucket{key: key}
+		s.buckets[key] = s.order.PushFront(bucket)
+	}
+
+	// (Re)create the limiter when first seen or when the limit changed
+	if bucket.limiter == nil || bucket.limit != limit {
+		bucket.limit = limit
+		bucket.limiter = rate.NewLimiter(limit.rate(), limit.burst())
+	}
+	bucket.lastSeen = now
+
+	allowed := bucket.limiter.AllowN(now, 1)
+	tokens := bucket.limiter.TokensAt(now)
+	perSecond := float64(limit.rate())
+
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit.burst(),
+		Remaining: max(int(tokens), 0),
+		Reset:     time.Duration((float64(limit.burst()) - tokens) / perSecond * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / perSecond * float64(time.Second))
+	}
+
+	return result, nil
+}
+
+// evict drops the buckets idle for longer than the ttl
+func (s *memoryRateLimitStore) evict(now time.Time) {
+	for element := s.order.Back(); element != nil; element = s.order.Back() {
+		bucket := element.Value.(*memoryBucket)
+		if now.Sub(bucket.lastSeen) < s.ttl {
+			return
+		}
+		s.order.Remove(element)
+		delete(s.buckets, bucket.key)
+	}
+}
@@ -0,0 +1,219 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// rateLimited serves requests through a RateLimit middleware, keyed by IP unless set
+func rateLimited(cfg RateLimitConfig) http.Handler {
+	if cfg.Key == nil {
+		cfg.Key = KeyByIP
+	}
+	return RateLimit(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// rateLimitRequest sends a request from ip and returns the response
+func rateLimitRequest(handler http.Handler, ip, path string, prepare ...func(*http.Request) *http.Request) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = ip + ":1234"
+	for _, p := range prepare {
+		req = p(req)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimitSeparateBuckets(t *testing.T) {
+	handler := rateLimited(RateLimitConfig{Limit: Limit{Requests: 2, Period: time.Minute}})
+
+	for i, want := range []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests} {
+		if rec := rateLimitRequest(handler, "192.0.2.1", "/"); rec.Code != want {
+			t.Errorf("request %d of the first client: status = %d, want %d", i+1, rec.Code, want)
+		}
+	}
+	if rec := rateLimitRequest(handler, "192.0.2.2", "/"); rec.Code != http.StatusNoContent {
+		t.Errorf("second client: status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	handler := rateLimited(RateLimitConfig{Limit: Limit{Requests: 2, Period: time.Minute}})
+
+	tests := []struct {
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{status: http.StatusNoContent, remaining: "1", reset: "30"},
+		{status: http.StatusNoContent, remaining: "0", reset: "60"},
+		{status: http.StatusTooManyRequests, remaining: "0", reset: "60", retryAfter: "30"},
+	}
+
+	for i, tt := range tests {
+		rec := rateLimitRequest(handler, "192.0.2.1", "/")
+		got := []string{
+			rec.Header().Get("RateLimit-Limit"),
+			rec.Header().Get("RateLimit-Remaining"),
+			rec.Header().Get("RateLimit-Reset"),
+			rec.Header().Get("Retry-After"),
+		}
+		want := []string{"2", tt.remaining, tt.reset, tt.retryAfter}
+		if rec.Code != tt.status || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] || got[3] != want[3] {
+			t.Errorf("request %d: got %d %v, want %d %v (limit, remaining, reset, retry after)", i+1, rec.Code, got, tt.status, want)
+		}
+	}
+}
+
+func TestRateLimitRules(t *testing.T) {
+	handler := rateLimited(RateLimitConfig{
+		Limit: Limit{Requests: 2, Period: time.Minute},
+		Rules: []RateLimitRule{
+			{PathPrefix: "/auth/", Limit: Limit{Requests: 1, Period: time.Minute}},
+			{PathPrefix: "/health", Limit: Limit{}},
+		},
+	})
+
+	steps := []struct {
+		path   string
+		status int
+	}{
+		{path: "/auth/google", status: http.StatusNoContent},
+		{path: "/auth/google/callback", status: http.StatusTooManyRequests},
+		// The strict rule has its own bucket, the default one is untouched
+		{path: "/", status: http.StatusNoContent},
+		{path: "/settings", status: http.StatusNoContent},
+		{path: "/", status: http.StatusTooManyRequests},
+		// Rules without limit aren't limited
+		{path: "/healthz", status: http.StatusNoContent},
+		{path: "/healthz", status: http.StatusNoContent},
+	}
+
+	for _, step := range steps {
+		if rec := rateLimitRequest(handler, "192.0.2.1", step.path); rec.Code != step.status {
+			t.Errorf("%s: status = %d, want %d", step.path, rec.Code, step.status)
+		}
+	}
+}
+
+func TestRateLimitAPITokens(t *testing.T) {
+	handler := rateLimited(RateLimitConfig{
+		Limit: Limit{Requests: 1, Period: time.Minute},
+		Key:   KeyFirst(KeyByAPIToken, KeyByIP),
+	})
+	bearer := func(token string) func(*http.Request) *http.Request {
+		return func(r *http.Request) *http.Request {
+			r.Header.Set("Authorization", "Bearer "+token)
+			return r
+		}
+	}
+	verified := func(tokenID string) func(*http.Request) *http.Request {
+		return func(r *http.Request) *http.Request {
+			return SetAPIToken(r, tokenID)
+		}
+	}
+
+	if rec := rateLimitRequest(handler, "192.0.2.1", "/api/items", bearer("random-1")); rec.Code != http.StatusNoContent {
+		t.Fatalf("first request: status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	// Unverified tokens count against the IP
+	if rec := rateLimitRequest(handler, "192.0.2.1", "/api/items", bearer("random-2")); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("random token: status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	// Verified tokens have their own bucket
+	if rec := rateLimitRequest(handler, "192.0.2.1", "/api/items", bearer("secret"), verified("7")); rec.Code != http.StatusNoContent {
+		t.Errorf("verified token: status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := rateLimitRequest(handler, "192.0.2.2", "/api/items", verified("7")); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("verified token from another IP: status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
+
+// failingStore is a RateLimitStore that is always unavailable
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store unavailable")
+}
+
+func TestRateLimitStoreFailure(t *testing.T) {
+	handler := rateLimited(RateLimitConfig{Limit: Limit{Requests: 1, Period: time.Minute}, Store: failingStore{}})
+
+	for range 3 {
+		if rec := rateLimitRequest(handler, "192.0.2.1", "/"); rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want the request served when the store fails", rec.Code)
+		}
+	}
+}
+
+// testMemoryStore returns a memory store reading the time from now
+func testMemoryStore(maxKeys int, ttl time.Duration, now *time.Time) *memoryRateLimitStore {
+	store := NewMemoryRateLimitStore(maxKeys, ttl).(*memoryRateLimitStore)
+	store.now = func() time.Time { return *now }
+	return store
+}
+
+// take takes a request from the bucket of key and reports whether it was allowed
+func take(t *testing.T, store RateLimitStore, key string) bool {
+	t.Helper()
+	result, err := store.Take(context.Background(), key, Limit{Requests: 1, Period: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Allowed
+}
+
+func TestMemoryRateLimitStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	now := time.Now()
+	store := testMemoryStore(2, time.Hour, &now)
+
+	take(t, store, "a")
+	take(t, store, "b")
+	// Using a again makes b the least recently used bucket, dropped to make room for c
+	if take(t, store, "a") {
+		t.Fatal("a: allowed twice within its limit")
+	}
+	take(t, store, "c")
+
+	if len(store.buckets) != 2 {
+		t.Errorf("%d buckets, want at most 2", len(store.buckets))
+	}
+	if take(t, store, "a") {
+		t.Error("a: bucket was evicted although recently used")
+	}
+	if !take(t, store, "b") {
+		t.Error("b: bucket wasn't evicted")
+	}
+}
+
+func TestMemoryRateLimitStoreEvictsIdleBuckets(t *testing.T) {
+	now := time.Now()
+	store := testMemoryStore(10, time.Minute, &now)
+
+	take(t, store, "a")
+	now = now.Add(30 * time.Second)
+	take(t, store, "b")
+
+	// a is idle for longer than the ttl, b isn't
+	now = now.Add(45 * time.Second)
+	take(t, store, "c")
+	if _, ok := store.buckets["a"]; ok {
+		t.Error("a: idle bucket wasn't evicted")
+	}
+	if _, ok := store.buckets["b"]; !ok {
+		t.Error("b: bucket evicted before its ttl")
+	}
+
+	// The limit of an evicted bucket starts over, although it wouldn't have refilled yet
+	if !take(t, store, "a") {
+		t.Error("a: evicted bucket still limited")
+	}
+}
@@ -1,27 +1,33 @@
 package router
 
 import (
-	"context"
-	"log/slog"
+	"fmt"
 	"net/http"
+	"net/netip"
 	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/accesslog"
 	"github.com/justinas/alice"
 	"github.com/rs/cors"
-	"golang.org/x/time/rate"
 )
 
 type Config struct {
-	EnableCORS        bool          // Enable CORS middleware
-	AllowedOrigins    []string      // CORS allowed origins
-	EnableCompression bool          // Enable gzip compression
-	EnableRateLimit   bool          // Enable rate limiting
-	RateLimitRPS      int           // Requests per second (if rate limiting enabled)
-	RateLimitBurst    int           // Burst size for rate limiter
-	RequestTimeout    time.Duration // Request timeout duration
-	LogRequests       bool          // Enable request logging
+	EnableCORS        bool              // Enable CORS middleware
+	AllowedOrigins    []string          // CORS allowed origins
+	EnableCompression bool              // Enable gzip compression
+	EnableRateLimit   bool              // Enable the global rate limit, an overload guard shared by all clients
+	RateLimitRPS      int               // Requests per second of all clients together (if rate limiting enabled)
+	RateLimitBurst    int               // Burst size for rate limiter
+	RequestTimeout    time.Duration     // Request timeout duration
+	Timeouts          []TimeoutRule     // Per route timeout overrides
+	LogRequests       bool              // Enable request logging
+	TrustedProxies    []netip.Prefix    // Proxies allowed to set forwarding headers
+	HSTSMaxAge        time.Duration     // Strict-Transport-Security max-age sent over HTTPS, 0 disables it
+	EnableMetrics     bool              // Record Prometheus metrics of the requests
+	EnableTracing     bool              // Start an OpenTelemetry span for each request
+	AccessLog         *accesslog.Logger // Written instead of slog when request logging is enabled
 }
 
 // DefaultConfig returns a production-ready default configuration
@@ -30,11 +36,13 @@ func DefaultConfig() Config {
 		EnableCORS:        true,
 		AllowedOrigins:    []string{"*"}, // Configure this for production!
 		EnableCompression: true,
-		EnableRateLimit:   true,
-		RateLimitRPS:      100,
+		EnableRateLimit:   false, // One noisy client would exhaust it for everyone
+		RateLimitRPS:      0,
 		RateLimitBurst:    200,
 		RequestTimeout:    30 * time.Second,
 		LogRequests:       true,
+		HSTSMaxAge:        365 * 24 * time.Hour,
+		EnableMetrics:     true,
 	}
 }
 
@@ -45,27 +53,29 @@ func New(cfg Config) *Router {
 	// Store config for later use
 	router := WrapRouter(r)
 	router.config = cfg
+	appRouter = r
 
 	// Build middleware chain using alice for clean composition
 	middleware := buildMiddlewareChain(cfg)
 
 	// Apply global middleware
-	r.Use(middleware.Then)
+	router.Use(middleware.Then)
+
+	// Requests matching no route get the same error pages as handlers
+	r.NotFoundHandler = router.fallback(ErrNotFound)
+	r.MethodNotAllowedHandler = router.fallback(ErrMethodNotAllowed)
 
 	return router
 }
 
 // NewWithHotReload creates a router and a separate mux for hot reload endpoints
 // that bypass problematic middleware (timeout, compression) for WebSocket connections
-func NewWithHotReload() (*Router, *mux.Router) {
+func NewWithHotReload(cfg Config) (*Router, *mux.Router) {
 	mainRouter := mux.NewRouter()
 	hotReloadRouter := mux.NewRouter()
 
-	cfg := DefaultConfig()
-
-	// Build middleware chain - only for main router
-	middleware := buildMiddlewareChain(cfg)
-	mainRouter.Use(middleware.Then)
+	// URLs of named routes are built from the main router
+	appRouter = mainRouter
 
 	// Wrap the main router for route registration
 	wrappedRouter := &Router{
@@ -74,6 +84,14 @@ func NewWithHotReload() (*Router, *mux.Router) {
 		hotReloadMux: hotReloadRouter,
 	}
 
+	// Build middleware chain - only for main router
+	middleware := buildMiddlewareChain(cfg)
+	wrappedRouter.Use(middleware.Then)
+
+	// Requests matching no route get the same error pages as handlers
+	mainRouter.NotFoundHandler = wrappedRouter.fallback(ErrNotFound)
+	mainRouter.MethodNotAllowedHandler = wrappedRouter.fallback(ErrMethodNotAllowed)
+
 	return wrappedRouter, hotReloadRouter
 }
 
@@ -81,19 +99,35 @@ func NewWithHotReload() (*Router, *mux.Router) {
 func buildMiddlewareChain(cfg Config) alice.Chain {
 	chain := alice.New()
 
-	// Recovery middleware - must be first to catch panics
-	chain = chain.Append(recoveryMiddleware())
+	// Metrics middleware - outside recovery so that panics are counted as 500
+	if cfg.EnableMetrics {
+		chain = chain.Append(metricsMiddleware())
+	}
+
+	// Tracing middleware - outside recovery so that panics end the span as errors
+	if cfg.EnableTracing {
+		chain = chain.Append(tracingMiddleware())
+	}
+
+	// Client IP, scheme and host resolution - before anything relying on them
+	chain = chain.Append(proxyMiddleware(cfg.TrustedProxies))
 
 	// Request ID middleware
 	chain = chain.Append(requestIDMiddleware())
 
+	// Request scoped logger - before anything logging
+	chain = chain.Append(contextLoggerMiddleware())
+
+	// Recovery middleware - catches the panics of handlers and of the middleware below
+	chain = chain.Append(recoveryMiddleware())
+
 	// Structured logging middleware
 	if cfg.LogRequests {
-		chain = chain.Append(structuredLoggerMiddleware())
+		chain = chain.Append(structuredLoggerMiddleware(cfg.AccessLog))
 	}
 
 	// Security headers middleware
-	chain = chain.Append(securityHeadersMiddleware())
+	chain = chain.Append(securityHeadersMiddleware(cfg.HSTSMaxAge))
 
 	// CORS middleware
 	if cfg.EnableCORS {
@@ -112,7 +146,7 @@ func buildMiddlewareChain(cfg Config) alice.Chain {
 
 	// Timeout middleware
 	if cfg.RequestTimeout > 0 {
-		chain = chain.Append(timeoutMiddleware(cfg.RequestTimeout))
+		chain = chain.Append(timeoutMiddleware(cfg.RequestTimeout, cfg.Timeouts))
 	}
 
 	return chain
@@ -124,7 +158,7 @@ func corsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Request-ID"},
-		ExposedHeaders:   []string{"Content-Length", "X-Request-ID"},
+		ExposedHeaders:   []string{"Content-Length", "X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           int((12 * time.Hour).Seconds()),
 	})
@@ -132,57 +166,29 @@ func corsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 	return c.Handler
 }
 
-// rateLimitMiddleware creates a rate limiting middleware using token bucket algorithm
+// rateLimitMiddleware creates a rate limiting middleware sharing a single token
+// bucket between all clients, a cap protecting the server as a whole
 func rateLimitMiddleware(rps, burst int) func(http.Handler) http.Handler {
-	limiter := rate.NewLimiter(rate.Limit(rps), burst)
-
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !limiter.Allow() {
-				http.Error(w, `{"error": "rate limit exceeded"}`, http.StatusTooManyRequests)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-// timeoutMiddleware creates a timeout middleware that cancels requests exceeding the timeout
-func timeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx, cancel := context.WithTimeout(r.Context(), timeout)
-			defer cancel()
-
-			r = r.WithContext(ctx)
-
-			done := make(chan struct{})
-			go func() {
-				next.ServeHTTP(w, r)
-				close(done)
-			}()
-
-			select {
-			case <-done:
-				return
-			case <-ctx.Done():
-				if ctx.Err() == context.DeadlineExceeded {
-					slog.Warn("request timeout", "path", r.URL.Path, "method", r.Method)
-					http.Error(w, `{"error": "request timeout"}`, http.StatusRequestTimeout)
-				}
-			}
-		})
-	}
+	return RateLimit(RateLimitConfig{
+		Limit: Limit{Requests: rps, Period: time.Second, Burst: burst},
+		Key:   KeyAll,
+		Name:  "global",
+	})
 }
 
 // securityHeadersMiddleware adds security headers to all responses
-func securityHeadersMiddleware() func(http.Handler) http.Handler {
+func securityHeadersMiddleware(hstsMaxAge time.Duration) func(http.Handler) http.Handler {
+	hsts := fmt.Sprintf("max-age=%d; includeSubDomains", int(hstsMaxAge.Seconds()))
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("X-Content-Type-Options", "nosniff")
 			w.Header().Set("X-Frame-Options", "DENY")
 			w.Header().Set("X-XSS-Protection", "1; mode=block")
-			w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+			// Browsers ignore HSTS received over plain HTTP
+			if hstsMaxAge > 0 && IsHTTPS(r) {
+				w.Header().Set("Strict-Transport-Security", hsts)
+			}
 			w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline' https://unpkg.com; style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; font-src 'self' https://fonts.gstatic.com; img-src 'self' https://*.googleusercontent.com data:; connect-src 'self' ws://localhost:* wss://localhost:* https://unpkg.com")
 			w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
 
@@ -0,0 +1,155 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeoutRule overrides the timeout of the requests whose path starts with
+// PathPrefix, a zero Timeout disables it (file downloads, long polling...).
+// Streamed responses (WebSocket, server-sent events) can't be buffered and need
+// a rule disabling the timeout of their routes.
+type TimeoutRule struct {
+	PathPrefix string
+	Route      RouteName // Instead of PathPrefix, the path of the named route up to its first variable
+	Timeout    time.Duration
+}
+
+// resolveTimeoutRules sets the prefix of the rules given by route name. Routes
+// are registered after the middleware is created, they're resolved on the first request.
+func resolveTimeoutRules(rules []TimeoutRule) []TimeoutRule {
+	resolved := make([]TimeoutRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Route != "" {
+			prefix, ok := routePrefix(rule.Route)
+			if !ok {
+				// An empty prefix would match every request
+				slog.Error("timeout rule of an unknown route", "route", rule.Route)
+				continue
+			}
+			rule.PathPrefix = prefix
+		}
+		resolved = append(resolved, rule)
+	}
+	return resolved
+}
+
+// timeoutMiddleware creates a timeout middleware that cancels requests exceeding the timeout.
+// The response is buffered and only sent when the handler finishes in time, so that
+// the timeout error and a late handler never write to the connection concurrently.
+func timeoutMiddleware(timeout time.Duration, rules []TimeoutRule) func(http.Handler) http.Handler {
+	resolveRules := sync.OnceValue(func() []TimeoutRule {
+		return resolveTimeoutRules(rules)
+	})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := timeout
+			for _, rule := range resolveRules() {
+				if strings.HasPrefix(r.URL.Path, rule.PathPrefix) {
+					d = rule.Timeout
+					break
+				}
+			}
+
+			if d <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan *PanicError, 1)
+			go func() {
+				defer func() {
+					if err := recover(); err != nil {
+						panicked <- newPanicError(err, debug.Stack())
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case err := <-panicked:
+				// Re-panic in the serving goroutine so the recovery middleware handles it
+				panic(err)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				dst := w.Header()
+				for key, values := range tw.header {
+					dst[key] = values
+				}
+				if !tw.wroteHeader {
+					tw.code = http.StatusOK
+				}
+				w.WriteHeader(tw.code)
+				w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+
+				if ctx.Err() == context.DeadlineExceeded {
+					WriteError(w, r, NewHTTPError(http.StatusRequestTimeout, "request timeout"))
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers a response until the handler finishes, writes made
+// after the timeout are discarded
+type timeoutWriter struct {
+	header http.Header // Only used by the handler until it returns
+
+	mu          sync.Mutex
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	tw.wroteHeader = true
+	tw.code = code
+}
@@ -0,0 +1,208 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	// Timeouts and panics are logged, which isn't what these tests look at
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestTimeoutMiddlewareDropsLateWrites(t *testing.T) {
+	release := make(chan struct{})
+	lateWrite := make(chan error, 1)
+	handler := timeoutMiddleware(20*time.Millisecond, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		<-release
+		w.Header().Set("X-Late", "true")
+		_, err := w.Write([]byte("late"))
+		lateWrite <- err
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	close(release)
+
+	if rec.Code != http.StatusRequestTimeout {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestTimeout)
+	}
+	if err := <-lateWrite; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("late write error = %v, want %v", err, http.ErrHandlerTimeout)
+	}
+	if strings.Contains(rec.Body.String(), "late") || rec.Header().Get("X-Late") != "" {
+		t.Errorf("late write reached the client: %q %v", rec.Body.String(), rec.Header())
+	}
+}
+
+func TestTimeoutMiddlewareWritesResponseInTime(t *testing.T) {
+	handler := timeoutMiddleware(time.Second, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "true")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/items", nil))
+
+	if rec.Code != http.StatusCreated || rec.Body.String() != "created" || rec.Header().Get("X-Handler") != "true" {
+		t.Errorf("got %d %q %v, want the handler response", rec.Code, rec.Body.String(), rec.Header())
+	}
+}
+
+func TestTimeoutMiddlewarePanicReachesRecovery(t *testing.T) {
+	var recovered any
+	catch := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if recovered = recover(); recovered != nil {
+					panic(recovered)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := recoveryMiddleware()(catch(timeoutMiddleware(time.Second, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	}))))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if strings.Contains(rec.Body.String(), "partial") {
+		t.Errorf("buffered response of the panicking handler was sent: %q", rec.Body.String())
+	}
+	panicErr, ok := recovered.(*PanicError)
+	if !ok || panicErr.Value != "boom" {
+		t.Fatalf("recovered %#v, want a *PanicError of boom", recovered)
+	}
+	if !strings.Contains(string(panicErr.Stack), "timeout_test.go") {
+		t.Errorf("stack doesn't point at the handler:\n%s", panicErr.Stack)
+	}
+}
+
+func TestTimeoutMiddlewareExemptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		exempt  bool
+	}{
+		{name: "rule without timeout", path: "/downloads/archive.zip", exempt: true},
+		{name: "server-sent events route", path: "/events", headers: map[string]string{"Accept": "text/event-stream"}, exempt: true},
+		// Clients can't lift the timeout of other routes by asking for a stream
+		{name: "server-sent events header", path: "/settings", headers: map[string]string{"Accept": "text/event-stream"}},
+		{name: "websocket header", path: "/settings", headers: map[string]string{"Upgrade": "websocket"}},
+	}
+
+	rules := []TimeoutRule{{PathPrefix: "/downloads/", Timeout: 0}, {PathPrefix: "/events", Timeout: 0}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := timeoutMiddleware(10*time.Millisecond, rules)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Streams write to the connection as they go, past the timeout
+				if _, ok := w.(http.Flusher); !ok && tt.exempt {
+					t.Error("response writer is buffered")
+				}
+				for i := range 3 {
+					fmt.Fprintf(w, "chunk %d\n", i)
+					time.Sleep(10 * time.Millisecond)
+				}
+				if err := r.Context().Err(); err != nil && tt.exempt {
+					t.Errorf("context cancelled: %v", err)
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			switch {
+			case tt.exempt && (rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "chunk 2")):
+				t.Errorf("got %d %q, want the whole stream", rec.Code, rec.Body.String())
+			case !tt.exempt && rec.Code != http.StatusRequestTimeout:
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestTimeout)
+			}
+		})
+	}
+}
+
+func TestTimeoutMiddlewareConcurrentRequests(t *testing.T) {
+	// Long enough for the fast requests to finish under the race detector
+	handler := timeoutMiddleware(200*time.Millisecond, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("slow") {
+			w.Header().Set("X-Progress", "true")
+			w.Write([]byte("."))
+			<-r.Context().Done()
+			w.Write([]byte("late"))
+			return
+		}
+		w.Write([]byte("fast"))
+	}))
+
+	var wg sync.WaitGroup
+	for i := range 200 {
+		slow := i%2 == 0
+		wg.Go(func() {
+			target := "/"
+			if slow {
+				target = "/?slow"
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+			switch {
+			case slow && rec.Code != http.StatusRequestTimeout:
+				t.Errorf("slow request: status = %d, want %d", rec.Code, http.StatusRequestTimeout)
+			case slow && strings.Contains(rec.Body.String(), "."):
+				t.Errorf("slow request: partial response was sent: %q", rec.Body.String())
+			case !slow && (rec.Code != http.StatusOK || rec.Body.String() != "fast"):
+				t.Errorf("fast request: got %d %q", rec.Code, rec.Body.String())
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestTimeoutRuleByRouteName(t *testing.T) {
+	r := New(Config{
+		RequestTimeout: 10 * time.Millisecond,
+		Timeouts: []TimeoutRule{
+			{Route: "downloads.show", Timeout: 0},
+			// Unknown routes are skipped instead of exempting every path
+			{Route: "missing", Timeout: 0},
+		},
+	})
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}
+	r.HandleFunc("/downloads/{id}", slow).Name("downloads.show")
+	r.HandleFunc("/settings", slow)
+
+	for path, want := range map[string]int{
+		"/downloads/42": http.StatusNoContent,
+		"/settings":     http.StatusRequestTimeout,
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
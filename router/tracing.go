@@ -0,0 +1,45 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/hyperstitieux/template/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingMiddleware starts a server span for each request, continuing the trace
+// of the caller when it sends a W3C traceparent header. The span is named after
+// the route template, known once mux matched the route.
+func tracingMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			route := routeTemplate(r)
+			ctx, span := tracing.Start(ctx, r.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("http.route", route),
+					attribute.String("url.path", r.URL.Path),
+					attribute.String("user_agent.original", r.UserAgent()),
+				),
+			)
+			defer span.End()
+
+			mrw := &metricsResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(mrw, r.WithContext(ctx))
+
+			span.SetAttributes(
+				attribute.Int("http.response.status_code", mrw.statusCode),
+				attribute.String("request.id", w.Header().Get("X-Request-ID")),
+			)
+			if mrw.statusCode >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(mrw.statusCode))
+			}
+		})
+	}
+}
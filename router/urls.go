@@ -0,0 +1,96 @@
+package router
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteName is the name of a route, given with Name when registering it
+type RouteName string
+
+var (
+	// appRouter is the router URLs are built from, set when creating the router
+	appRouter *mux.Router
+
+	referencedMutex  sync.Mutex
+	referencedRoutes []RouteName
+)
+
+// NamedRoute declares a route name referenced by views or controllers. Declare
+// them as package variables so CheckRoutes can verify them at startup.
+func NamedRoute(name string) RouteName {
+	referencedMutex.Lock()
+	defer referencedMutex.Unlock()
+
+	referencedRoutes = append(referencedRoutes, RouteName(name))
+	return RouteName(name)
+}
+
+// URL builds the path of a named route, params are the route variables as key/value pairs:
+//
+//	router.URL(routes.AdminUser, "id", "42") // "/admin/users/42"
+func URL(name RouteName, params ...string) string {
+	if appRouter == nil {
+		slog.Error("url built before the router was created", "route", name)
+		return "/"
+	}
+
+	route := appRouter.Get(string(name))
+	if route == nil {
+		slog.Error("url built for an unknown route", "route", name)
+		return "/"
+	}
+
+	url, err := route.URLPath(params...)
+	if err != nil {
+		slog.Error("failed to build route url", "route", name, "error", err)
+		return "/"
+	}
+	return url.String()
+}
+
+// routePrefix returns the path template of a named route up to its first variable
+func routePrefix(name RouteName) (string, bool) {
+	if appRouter == nil {
+		return "", false
+	}
+	route := appRouter.Get(string(name))
+	if route == nil {
+		return "", false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	prefix, _, _ := strings.Cut(template, "{")
+	return prefix, true
+}
+
+// CheckRoutes verifies that every route declared with NamedRoute was registered
+func (r *Router) CheckRoutes() error {
+	referencedMutex.Lock()
+	defer referencedMutex.Unlock()
+
+	var missing []string
+	for _, name := range referencedRoutes {
+		if r.Router.Get(string(name)) == nil && !slices.Contains(missing, string(name)) {
+			missing = append(missing, string(name))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("unknown routes referenced: %s", strings.Join(missing, ", "))
+	}
+
+	// Name errors (a route named twice) are only reported when walking the routes
+	return r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if err := route.GetError(); err != nil {
+			return fmt.Errorf("invalid route %q: %w", route.GetName(), err)
+		}
+		return nil
+	})
+}
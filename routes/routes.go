@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"net/url"
+
+	"github.com/hyperstitieux/template/router"
+)
+
+// Names of the routes linked to by views and controllers, checked at startup
+// against the registered routes
+var (
+	Home = router.NamedRoute("home")
+
+	GoogleSignIn      = router.NamedRoute("auth.google")
+	GoogleCallback    = router.NamedRoute("auth.google.callback")
+	SignOut           = router.NamedRoute("auth.sign_out")
+	ImpersonationStop = router.NamedRoute("auth.impersonation.stop")
+
+	Settings              = router.NamedRoute("settings")
+	SettingsUpdateProfile = router.NamedRoute("settings.update_profile")
+	SettingsChangeEmail   = router.NamedRoute("settings.change_email")
+	SettingsVerifyEmail   = router.NamedRoute("settings.verify_email")
+	SettingsDeleteAccount = router.NamedRoute("settings.delete_account")
+	DataExport            = router.NamedRoute("settings.export")
+	DataExportDownload    = router.NamedRoute("settings.export.download")
+
+	OpenAPI = router.NamedRoute("openapi")
+
+	AdminUsers              = router.NamedRoute("admin.users")
+	AdminUser               = router.NamedRoute("admin.user")
+	AdminUserRevokeSessions = router.NamedRoute("admin.user.sessions.revoke")
+	AdminUserRevokeSession  = router.NamedRoute("admin.user.session.revoke")
+	AdminUserDisable        = router.NamedRoute("admin.user.disable")
+	AdminUserEnable         = router.NamedRoute("admin.user.enable")
+	AdminUserDelete         = router.NamedRoute("admin.user.delete")
+	AdminUserImpersonate    = router.NamedRoute("admin.user.impersonate")
+)
+
+// SignIn returns the URL starting the sign in flow, coming back to redirect afterwards
+func SignIn(redirect string) string {
+	return router.URL(GoogleSignIn) + "?redirect=" + url.QueryEscape(redirect)
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Config holds the settings of the HTTP server
+type Config struct {
+	Addr              string        `toml:"addr" yaml:"addr"`
+	ReadHeaderTimeout time.Duration `toml:"read_header_timeout" yaml:"read_header_timeout"` // Time allowed to read the request headers
+	ReadTimeout       time.Duration `toml:"read_timeout" yaml:"read_timeout"`               // Time allowed to read the whole request, body included
+	WriteTimeout      time.Duration `toml:"write_timeout" yaml:"write_timeout"`             // Time allowed to write the response, downloads included
+	IdleTimeout       time.Duration `toml:"idle_timeout" yaml:"idle_timeout"`               // How long keep-alive connections wait for the next request
+	ShutdownTimeout   time.Duration `toml:"shutdown_timeout" yaml:"shutdown_timeout"`       // Time given to in-flight requests and background work on shutdown
+	DrainDelay        time.Duration `toml:"drain_delay" yaml:"drain_delay"`                 // Time load balancers get to notice the server isn't ready before it stops listening
+
+	// TLS is terminated by the server when both files are set, the certificate
+	// is reloaded when the files change
+	TLSCertFile string `toml:"tls_cert_file" yaml:"tls_cert_file"`
+	TLSKeyFile  string `toml:"tls_key_file" yaml:"tls_key_file"`
+	// RedirectAddr is the address of a plain HTTP listener redirecting to HTTPS (e.g. ":80"),
+	// only used with TLS
+	RedirectAddr string `toml:"redirect_addr" yaml:"redirect_addr"`
+}
+
+// TLS reports whether the server terminates TLS itself
+func (c Config) TLS() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// DefaultConfig returns timeouts suited to pages and small uploads
+func DefaultConfig() Config {
+	return Config{
+		Addr:              ":8080",
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      2 * time.Minute,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   30 * time.Second,
+	}
+}
+
+// Hook releases a resource on shutdown, it should return once ctx is done
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	fn   Hook
+}
+
+// Server runs the HTTP server until the process is asked to stop, then drains
+// the in-flight requests and runs the shutdown hooks
+type Server struct {
+	config Config
+	http   *http.Server
+	extra  []*http.Server // Plain HTTP listeners next to the main one
+	drains []func()
+	hooks  []namedHook
+}
+
+// New creates a server for handler, it doesn't listen until Run is called
+func New(cfg Config, handler http.Handler) *Server {
+	s := &Server{
+		config: cfg,
+		http:   newHTTPServer(cfg, cfg.Addr, handler),
+	}
+	if cfg.TLS() && cfg.RedirectAddr != "" {
+		s.Listen(cfg.RedirectAddr, redirectHandler(cfg.Addr))
+	}
+	return s
+}
+
+// Listen adds a plain HTTP listener on addr, started and shut down with the
+// main one (e.g. internal endpoints that mustn't be exposed publicly)
+func (s *Server) Listen(addr string, handler http.Handler) {
+	s.extra = append(s.extra, newHTTPServer(s.config, addr, handler))
+}
+
+// newHTTPServer creates an http.Server with the timeouts of cfg
+func newHTTPServer(cfg Config, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// OnDrain registers a function called as soon as the shutdown starts, while
+// requests are still served, e.g. to fail readiness probes
+func (s *Server) OnDrain(fn func()) {
+	s.drains = append(s.drains, fn)
+}
+
+// OnShutdown registers a hook run once the HTTP server stopped accepting requests.
+// Hooks run in registration order, so resources used by others are registered last.
+func (s *Server) OnShutdown(name string, hook Hook) {
+	s.hooks = append(s.hooks, namedHook{name: name, fn: hook})
+}
+
+// Run serves requests until ctx is done or SIGINT/SIGTERM is received, then shuts
+// down gracefully within the shutdown timeout. A second signal stops the process.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var errs []error
+	serveErr := make(chan error, len(s.extra)+1)
+	if err := s.listen(serveErr); err != nil {
+		// The server never started, release what was already opened
+		errs = append(errs, err)
+	} else {
+		select {
+		case err := <-serveErr:
+			errs = append(errs, err)
+		case <-ctx.Done():
+			stop()
+			slog.Info("shutting down", "timeout", s.config.ShutdownTimeout)
+			s.drain()
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	for _, srv := range append(s.extra, s.http) {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			// Requests still running past the deadline are cut
+			srv.Close()
+			errs = append(errs, fmt.Errorf("failed to drain http requests: %w", err))
+		}
+	}
+
+	for _, hook := range s.hooks {
+		if err := hook.fn(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", hook.name, err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	slog.Info("shutdown complete")
+	return nil
+}
+
+// drain runs the drain functions and keeps serving requests for the drain delay
+func (s *Server) drain() {
+	for _, fn := range s.drains {
+		fn()
+	}
+	if s.config.DrainDelay > 0 {
+		slog.Info("draining traffic before closing listeners", "delay", s.config.DrainDelay)
+		time.Sleep(s.config.DrainDelay)
+	}
+}
+
+// listen starts the listeners in the background, their errors are sent to serveErr
+func (s *Server) listen(serveErr chan<- error) error {
+	for _, srv := range s.extra {
+		go func() {
+			slog.Info("http server listening", "addr", srv.Addr)
+			if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- fmt.Errorf("failed to start http server on %s: %w", srv.Addr, err)
+			}
+		}()
+	}
+
+	if !s.config.TLS() {
+		go func() {
+			slog.Info("http server listening", "addr", s.config.Addr)
+			if err := s.http.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- fmt.Errorf("failed to start http server: %w", err)
+			}
+		}()
+		return nil
+	}
+
+	certs, err := newCertReloader(s.config.TLSCertFile, s.config.TLSKeyFile)
+	if err != nil {
+		return err
+	}
+	s.http.TLSConfig = tlsConfig(certs)
+
+	go func() {
+		slog.Info("https server listening", "addr", s.config.Addr)
+		if err := s.http.ListenAndServeTLS("", ""); !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- fmt.Errorf("failed to start https server: %w", err)
+		}
+	}()
+	return nil
+}
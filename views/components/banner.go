@@ -5,9 +5,17 @@ import (
 
 	"github.com/frenchsoftware/libhtml/attr"
 	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
 )
 
-func Banner() html.Node {
+// Banner renders the top bar, replaced by a warning while an admin impersonates a user
+func Banner(impersonator *models.User, user *models.User) html.Node {
+	if impersonator != nil && user != nil {
+		return ImpersonationBanner(impersonator, user)
+	}
+
 	return html.Div(
 		attr.Class("flex justify-end w-full bg-black text-white dark:bg-secondary border-b border-transparent dark:border-border px-8 py-2"),
 		html.Div(
@@ -17,3 +25,29 @@ func Banner() html.Node {
 		),
 	)
 }
+
+// ImpersonationBanner warns that the page is seen through another user's account
+func ImpersonationBanner(impersonator *models.User, user *models.User) html.Node {
+	return html.Div(
+		attr.Class("flex flex-wrap items-center justify-between gap-2 w-full bg-destructive text-white px-8 py-2"),
+		html.Attr("role", "alert"),
+		html.Div(
+			attr.Class("flex items-center gap-2 text-sm"),
+			html.I(html.Attr("data-lucide", "venetian-mask")),
+			html.Span(
+				html.Text("You are impersonating "),
+				html.Strong(html.Text(user.Name+" ("+user.Email+")")),
+				html.Text(" as "+impersonator.Name),
+			),
+		),
+		html.Form(
+			attr.Action(router.URL(routes.ImpersonationStop)),
+			attr.Method("POST"),
+			html.Button(
+				attr.Type("submit"),
+				attr.Class("btn-sm-outline text-foreground"),
+				html.Text("Stop impersonating"),
+			),
+		),
+	)
+}
@@ -2,10 +2,13 @@ package components
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/frenchsoftware/libhtml/attr"
 	"github.com/frenchsoftware/libhtml/html"
 	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
 	"github.com/hyperstitieux/template/views/components/icons"
 )
 
@@ -61,7 +64,7 @@ func Header(user *models.User, r *http.Request) html.Node {
 					// Settings menu item
 					html.A(
 						html.Attr("role", "menuitem"),
-						attr.Href("/settings"),
+						attr.Href(router.URL(routes.Settings)),
 						attr.Class("flex cursor-pointer items-center gap-2"),
 						html.I(html.Attr("data-lucide", "settings")),
 						html.Text("Settings"),
@@ -71,7 +74,7 @@ func Header(user *models.User, r *http.Request) html.Node {
 					// Logout menu item
 					html.A(
 						html.Attr("role", "menuitem"),
-						attr.Href("/auth/sign-out"),
+						attr.Href(router.URL(routes.SignOut)),
 						attr.Class("flex cursor-pointer items-center gap-2 text-destructive"),
 						html.I(html.Attr("data-lucide", "log-out"), attr.Class("text-destructive")),
 						html.Text("Log out"),
@@ -85,7 +88,7 @@ func Header(user *models.User, r *http.Request) html.Node {
 			attr.Class("flex items-center"),
 			html.A(
 				attr.Class("btn-primary h-9 flex items-center"),
-				attr.Href("/auth/google"),
+				attr.Href(router.URL(routes.GoogleSignIn)),
 				icons.Google(),
 				html.Span(
 					attr.Class("font-medium"),
@@ -103,7 +106,7 @@ func Header(user *models.User, r *http.Request) html.Node {
 			attr.Class("flex flex-wrap items-center gap-4"),
 			// Logo
 			html.A(
-				attr.Href("/"),
+				attr.Href(router.URL(routes.Home)),
 				html.Attr("data-tooltip", "Go back home"),
 				html.Attr("data-side", "bottom"),
 				html.H1(
@@ -116,10 +119,17 @@ func Header(user *models.User, r *http.Request) html.Node {
 			html.Div(
 				attr.Class("flex flex-wrap items-center gap-2"),
 				html.A(
-					attr.Href("/"),
+					attr.Href(router.URL(routes.Home)),
 					attr.ClassIfElse(currentPath == "/", "btn-ghost bg-accent", "btn-ghost"),
 					html.Text("Home"),
 				),
+				html.If(user != nil && user.IsAdmin(),
+					html.A(
+						attr.Href(router.URL(routes.AdminUsers)),
+						attr.ClassIfElse(strings.HasPrefix(currentPath, router.URL(routes.AdminUsers)), "btn-ghost bg-accent", "btn-ghost"),
+						html.Text("Admin"),
+					),
+				),
 			),
 		),
 
@@ -1,16 +1,15 @@
 package components
 
 import (
-	"os"
-
 	"github.com/frenchsoftware/libhtml/attr"
 	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/router"
 )
 
 // HotReloadScript adds the hot reload script in development mode
 func HotReloadScript() html.Node {
 	// Only add in development mode
-	if os.Getenv("GO_ENV") == "production" {
+	if !router.HotReloadEnabled() {
 		return nil
 	}
 
@@ -5,6 +5,7 @@ import (
 
 	"github.com/frenchsoftware/libhtml/attr"
 	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/auth"
 	"github.com/hyperstitieux/template/database/models"
 	"github.com/hyperstitieux/template/views/components"
 )
@@ -54,7 +55,7 @@ func Base(user *models.User, r *http.Request, title string, children ...html.Nod
 			html.Body(
 				attr.Class("font-sans min-h-screen flex flex-col"),
 
-				components.Banner(),
+				components.Banner(auth.GetImpersonator(r), user),
 				components.Header(user, r),
 
 				// Main content area - takes remaining space
@@ -0,0 +1,417 @@
+package pages
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+const adminDateFormat = "2 Jan 2006 15:04"
+
+// AdminUsersProps holds the data rendered by the admin user list
+type AdminUsersProps struct {
+	Users   []*models.User
+	Search  string
+	Page    int
+	PerPage int
+	Total   int
+}
+
+func AdminUsers(w http.ResponseWriter, r *http.Request, props AdminUsersProps) error {
+	user := auth.GetCurrentUser(r)
+
+	lastPage := (props.Total + props.PerPage - 1) / props.PerPage
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	page := layouts.Base(user, r, "Users - Admin - French Software",
+		html.Div(
+			attr.Class("max-w-6xl mx-auto px-8 py-8"),
+
+			// Page header
+			html.Div(
+				attr.Class("mb-8"),
+				html.H1(
+					attr.Class("text-3xl font-semibold mb-2"),
+					html.Text("Users"),
+				),
+				html.P(
+					attr.Class("text-muted-foreground"),
+					html.Text(strconv.Itoa(props.Total)+" users"),
+				),
+			),
+
+			ui.Card(
+				ui.CardSection(
+					// Search form
+					html.Form(
+						attr.Action(router.URL(routes.AdminUsers)),
+						attr.Method("GET"),
+						attr.Class("flex gap-2"),
+						html.Input(
+							attr.Type("search"),
+							attr.Name("q"),
+							attr.Value(props.Search),
+							attr.Placeholder("Search by name or email"),
+							attr.Class("input"),
+						),
+						html.Button(
+							attr.Type("submit"),
+							attr.Class("btn-outline"),
+							html.Text("Search"),
+						),
+					),
+
+					// Users table
+					html.Table(
+						attr.Class("table"),
+						html.Thead(
+							html.Tr(
+								html.Th(html.Text("Name")),
+								html.Th(html.Text("Email")),
+								html.Th(html.Text("Role")),
+								html.Th(html.Text("Status")),
+								html.Th(html.Text("Created")),
+							),
+						),
+						html.Tbody(
+							html.Map(props.Users, func(u *models.User) html.Node {
+								return html.Tr(
+									html.Td(
+										html.A(
+											attr.Href(router.URL(routes.AdminUser, "id", strconv.FormatInt(u.ID, 10))),
+											attr.Class("font-medium hover:underline"),
+											html.Text(u.Name),
+										),
+									),
+									html.Td(html.Text(u.Email)),
+									html.Td(html.Text(u.Role)),
+									html.Td(userStatusBadge(u)),
+									html.Td(html.Text(u.CreatedAt.Format(adminDateFormat))),
+								)
+							}),
+						),
+					),
+					html.If(len(props.Users) == 0,
+						html.P(
+							attr.Class("text-sm text-muted-foreground"),
+							html.Text("No users found"),
+						),
+					),
+				),
+				ui.CardFooter(
+					html.Div(
+						attr.Class("flex w-full items-center justify-between"),
+						html.Span(
+							attr.Class("text-sm text-muted-foreground"),
+							html.Text(fmt.Sprintf("Page %d of %d", props.Page, lastPage)),
+						),
+						html.Div(
+							attr.Class("flex gap-2"),
+							html.If(props.Page > 1,
+								html.A(
+									attr.Href(adminUsersURL(props.Search, props.Page-1)),
+									attr.Class("btn-sm-outline"),
+									html.Text("Previous"),
+								),
+							),
+							html.If(props.Page < lastPage,
+								html.A(
+									attr.Href(adminUsersURL(props.Search, props.Page+1)),
+									attr.Class("btn-sm-outline"),
+									html.Text("Next"),
+								),
+							),
+						),
+					),
+				),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// AdminUserProps holds the data rendered by the admin user detail page
+type AdminUserProps struct {
+	User        *models.User
+	Sessions    []*models.Session
+	AuditEvents []*models.AuditEvent
+}
+
+func AdminUser(w http.ResponseWriter, r *http.Request, props AdminUserProps) error {
+	current := auth.GetCurrentUser(r)
+	target := props.User
+	id := strconv.FormatInt(target.ID, 10)
+	isSelf := current != nil && current.ID == target.ID
+
+	page := layouts.Base(current, r, target.Name+" - Admin - French Software",
+		html.Div(
+			attr.Class("max-w-6xl mx-auto px-8 py-8"),
+
+			// Page header
+			html.Div(
+				attr.Class("mb-8 flex flex-col gap-2"),
+				html.A(
+					attr.Href(router.URL(routes.AdminUsers)),
+					attr.Class("text-sm text-muted-foreground hover:underline"),
+					html.Text("← All users"),
+				),
+				html.Div(
+					attr.Class("flex items-center gap-3"),
+					html.H1(
+						attr.Class("text-3xl font-semibold"),
+						html.Text(target.Name),
+					),
+					userStatusBadge(target),
+				),
+				html.P(
+					attr.Class("text-muted-foreground"),
+					html.Text(target.Email),
+				),
+			),
+
+			html.Div(
+				attr.Class("flex flex-col gap-6"),
+
+				// Profile card
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{Title: "Profile"}),
+					ui.CardSection(
+						html.Dl(
+							attr.Class("grid grid-cols-1 sm:grid-cols-2 gap-4 text-sm"),
+							detailItem("ID", strconv.FormatInt(target.ID, 10)),
+							detailItem("Role", target.Role),
+							detailItem("Google email", target.ProviderEmail),
+							detailItem("Google ID", target.GoogleID),
+							detailItem("Created", target.CreatedAt.Format(adminDateFormat)),
+							detailItem("Updated", target.UpdatedAt.Format(adminDateFormat)),
+							html.If(target.DisabledAt != nil,
+								detailItem("Disabled", formatTime(target.DisabledAt)),
+							),
+							html.If(target.DisabledReason != nil,
+								detailItem("Disabled reason", derefString(target.DisabledReason)),
+							),
+							html.If(target.PurgeAfter != nil,
+								detailItem("Deletion scheduled", formatTime(target.PurgeAfter)),
+							),
+						),
+					),
+					html.IfNot(isSelf,
+						ui.CardFooter(
+							html.IfElse(target.IsDisabled(),
+								postButton(router.URL(routes.AdminUserEnable, "id", id), "btn-outline", "Enable user"),
+								html.Button(
+									attr.Type("button"),
+									attr.Class("btn-outline"),
+									html.Attr("onclick", "document.getElementById('disable-user-dialog').showModal()"),
+									html.Text("Disable user"),
+								),
+							),
+							html.If(!target.IsAdmin() && !target.IsDisabled() && !target.IsPendingDeletion() && !target.IsPurged(),
+								postButton(router.URL(routes.AdminUserImpersonate, "id", id), "btn-outline", "Impersonate"),
+							),
+							html.If(!target.IsPendingDeletion() && !target.IsPurged(),
+								postButton(router.URL(routes.AdminUserDelete, "id", id), "btn-destructive", "Delete user"),
+							),
+						),
+					),
+				),
+
+				// Sessions card
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Sessions",
+						Description: strconv.Itoa(len(props.Sessions)) + " active sessions",
+					}),
+					ui.CardSection(
+						html.Table(
+							attr.Class("table"),
+							html.Thead(
+								html.Tr(
+									html.Th(html.Text("ID")),
+									html.Th(html.Text("Created")),
+									html.Th(html.Text("Expires")),
+									html.Th(),
+								),
+							),
+							html.Tbody(
+								html.Map(props.Sessions, func(s *models.Session) html.Node {
+									return html.Tr(
+										html.Td(html.Text(strconv.FormatInt(s.ID, 10))),
+										html.Td(html.Text(s.CreatedAt.Format(adminDateFormat))),
+										html.Td(html.Text(s.ExpiresAt.Format(adminDateFormat))),
+										html.Td(
+											attr.Class("text-right"),
+											postButton(router.URL(routes.AdminUserRevokeSession, "id", id, "sessionID", strconv.FormatInt(s.ID, 10)), "btn-sm-outline", "Revoke"),
+										),
+									)
+								}),
+							),
+						),
+					),
+					html.If(len(props.Sessions) > 0,
+						ui.CardFooter(
+							postButton(router.URL(routes.AdminUserRevokeSessions, "id", id), "btn-outline", "Revoke all sessions"),
+						),
+					),
+				),
+
+				// Audit trail card
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Audit trail",
+						Description: "Latest events about this user",
+					}),
+					ui.CardSection(
+						html.Table(
+							attr.Class("table"),
+							html.Thead(
+								html.Tr(
+									html.Th(html.Text("Date")),
+									html.Th(html.Text("Action")),
+									html.Th(html.Text("Actor")),
+									html.Th(html.Text("IP")),
+									html.Th(html.Text("Request ID")),
+								),
+							),
+							html.Tbody(
+								html.Map(props.AuditEvents, func(e *models.AuditEvent) html.Node {
+									actor := "system"
+									if e.ActorID != nil {
+										actor = "#" + strconv.FormatInt(*e.ActorID, 10)
+									}
+									return html.Tr(
+										html.Td(html.Text(e.CreatedAt.Format(adminDateFormat))),
+										html.Td(html.Code(html.Text(e.Action))),
+										html.Td(html.Text(actor)),
+										html.Td(html.Text(e.IP)),
+										html.Td(attr.Class("text-xs text-muted-foreground"), html.Text(e.RequestID)),
+									)
+								}),
+							),
+						),
+					),
+				),
+			),
+		),
+
+		disableUserDialog(router.URL(routes.AdminUserDisable, "id", id)),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// disableUserDialog asks for the reason shown to the user once disabled
+func disableUserDialog(action string) html.Node {
+	return ui.Dialog(ui.DialogProps{
+		ID:          "disable-user-dialog",
+		Title:       "Disable user",
+		Description: "The user is signed out immediately and can't sign in until enabled again.",
+		Content: html.Form(
+			attr.Id("disable-user-form"),
+			attr.Action(action),
+			attr.Method("POST"),
+			attr.Class("flex flex-col gap-2"),
+			html.Label(
+				attr.For("reason"),
+				attr.Class("text-sm font-medium"),
+				html.Text("Reason (shown to the user)"),
+			),
+			html.Textarea(
+				attr.Id("reason"),
+				attr.Name("reason"),
+				attr.Maxlength("500"),
+				attr.Class("textarea"),
+			),
+		),
+		Footer: html.Group(
+			html.Button(
+				attr.Type("button"),
+				attr.Class("btn-outline"),
+				html.Attr("onclick", "this.closest('dialog').close()"),
+				html.Text("Cancel"),
+			),
+			html.Button(
+				attr.Type("submit"),
+				attr.Form("disable-user-form"),
+				attr.Class("btn-destructive"),
+				html.Text("Disable user"),
+			),
+		),
+	})
+}
+
+// userStatusBadge renders the account state of a user
+func userStatusBadge(u *models.User) html.Node {
+	switch {
+	case u.IsPendingDeletion() || u.IsPurged():
+		return html.Span(attr.Class("badge-destructive"), html.Text("Deleted"))
+	case u.IsDisabled():
+		return html.Span(attr.Class("badge-secondary"), html.Text("Disabled"))
+	default:
+		return html.Span(attr.Class("badge-outline"), html.Text("Active"))
+	}
+}
+
+// detailItem renders a label/value pair of a description list
+func detailItem(label, value string) html.Node {
+	return html.Div(
+		html.Dt(attr.Class("text-muted-foreground"), html.Text(label)),
+		html.Dd(attr.Class("font-medium break-all"), html.Text(value)),
+	)
+}
+
+// postButton renders a button submitting an empty POST form to action
+func postButton(action, class, label string) html.Node {
+	return html.Form(
+		attr.Action(action),
+		attr.Method("POST"),
+		attr.Class("inline"),
+		html.Button(
+			attr.Type("submit"),
+			attr.Class(class),
+			html.Text(label),
+		),
+	)
+}
+
+// adminUsersURL builds the user list URL for a search and page
+func adminUsersURL(search string, page int) string {
+	query := url.Values{}
+	if search != "" {
+		query.Set("q", search)
+	}
+	query.Set("page", strconv.Itoa(page))
+	return router.URL(routes.AdminUsers) + "?" + query.Encode()
+}
+
+// derefString dereferences an optional string for display
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// formatTime formats an optional time for display
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(adminDateFormat)
+}
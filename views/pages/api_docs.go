@@ -0,0 +1,220 @@
+package pages
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+// APIDocs renders the operations of the OpenAPI document
+func APIDocs(w http.ResponseWriter, r *http.Request, doc *router.OpenAPIDocument) error {
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var operations []any
+	for _, path := range paths {
+		methods := make([]string, 0, len(doc.Paths[path]))
+		for method := range doc.Paths[path] {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			operations = append(operations, apiOperation(doc, method, path, doc.Paths[path][method]))
+		}
+	}
+
+	page := layouts.Base(auth.GetCurrentUser(r), r, "API - French Software",
+		html.Div(
+			attr.Class("max-w-4xl mx-auto px-8 py-8"),
+
+			// Page header
+			html.Div(
+				attr.Class("mb-8"),
+				html.H1(
+					attr.Class("text-3xl font-semibold mb-2"),
+					html.Text(doc.Info.Title),
+				),
+				html.P(
+					attr.Class("text-muted-foreground"),
+					html.Text("Version "+doc.Info.Version+". The OpenAPI document is available at "),
+					html.A(attr.Href(router.URL(routes.OpenAPI)), attr.Class("underline"), html.Text(router.URL(routes.OpenAPI))),
+					html.Text("."),
+				),
+			),
+
+			html.Div(
+				attr.Class("flex flex-col gap-6"),
+				html.Group(operations...),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// apiOperation renders an operation with its parameters, body and responses
+func apiOperation(doc *router.OpenAPIDocument, method, path string, op *router.OpenAPIOperation) html.Node {
+	var body *router.Schema
+	if op.RequestBody != nil {
+		if content, ok := op.RequestBody.Content["application/json"]; ok {
+			body = doc.Resolve(content.Schema)
+		}
+	}
+
+	statuses := make([]string, 0, len(op.Responses))
+	for status := range op.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	// Sections are built conditionally as html.If evaluates its children eagerly
+	sections := []any{attr.Class("flex flex-col gap-4")}
+	if len(op.Parameters) > 0 {
+		sections = append(sections, html.Div(
+			html.H3(attr.Class("font-medium mb-2"), html.Text("Parameters")),
+			schemaTable(html.Map(op.Parameters, func(p *router.OpenAPIParameter) html.Node {
+				return schemaRow(p.Name+" ("+p.In+")", p.Schema, p.Required)
+			})),
+		))
+	}
+	if body != nil {
+		sections = append(sections, html.Div(
+			html.H3(attr.Class("font-medium mb-2"), html.Text("Request body (JSON or form)")),
+			schemaFields(body),
+		))
+	}
+	sections = append(sections, html.Div(
+		html.H3(attr.Class("font-medium mb-2"), html.Text("Responses")),
+		html.Ul(
+			attr.Class("flex flex-col gap-2 text-sm"),
+			html.Map(statuses, func(status string) html.Node {
+				response := op.Responses[status]
+				description := response.Description
+				if content, ok := response.Content["application/json"]; ok {
+					description += " — " + schemaType(content.Schema)
+				}
+				return html.Li(
+					html.Span(attr.Class("badge-outline mr-2"), html.Text(status)),
+					html.Text(description),
+				)
+			}),
+		),
+	))
+
+	// Fields of the successful responses
+	for _, status := range statuses {
+		content, ok := op.Responses[status].Content["application/json"]
+		if !strings.HasPrefix(status, "2") || !ok {
+			continue
+		}
+		if schema := doc.Resolve(content.Schema); schema != nil && len(schema.Properties) > 0 {
+			sections = append(sections, html.Div(
+				html.H3(attr.Class("font-medium mb-2"), html.Text(status+" response")),
+				schemaFields(schema),
+			))
+		}
+	}
+
+	return ui.Card(
+		ui.CardHeader(ui.CardHeaderProps{
+			Title:       strings.ToUpper(method) + " " + path,
+			Description: op.Summary,
+		}),
+		ui.CardSection(html.Div(sections...)),
+	)
+}
+
+// schemaFields renders the properties of an object schema
+func schemaFields(schema *router.Schema) html.Node {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return schemaTable(html.Map(names, func(name string) html.Node {
+		return schemaRow(name, schema.Properties[name], slices.Contains(schema.Required, name))
+	}))
+}
+
+// schemaTable renders a table of fields
+func schemaTable(rows html.Node) html.Node {
+	return html.Table(
+		attr.Class("table"),
+		html.Thead(
+			html.Tr(
+				html.Th(html.Text("Name")),
+				html.Th(html.Text("Type")),
+				html.Th(html.Text("Constraints")),
+			),
+		),
+		html.Tbody(rows),
+	)
+}
+
+// schemaRow renders a field of a schema table
+func schemaRow(name string, schema *router.Schema, required bool) html.Node {
+	var constraints []string
+	if required {
+		constraints = append(constraints, "required")
+	}
+	if schema.MinLength != nil {
+		constraints = append(constraints, fmt.Sprintf("at least %d characters", *schema.MinLength))
+	}
+	if schema.MaxLength != nil {
+		constraints = append(constraints, fmt.Sprintf("at most %d characters", *schema.MaxLength))
+	}
+	if schema.Pattern != "" {
+		constraints = append(constraints, "matches "+schema.Pattern)
+	}
+
+	return html.Tr(
+		html.Td(attr.Class("font-mono text-sm"), html.Text(name)),
+		html.Td(html.Text(schemaType(schema))),
+		html.Td(attr.Class("text-muted-foreground"), html.Text(strings.Join(constraints, ", "))),
+	)
+}
+
+// schemaType describes the type of a schema in a few words
+func schemaType(schema *router.Schema) string {
+	if schema.Ref != "" {
+		return schema.Ref[strings.LastIndex(schema.Ref, "/")+1:]
+	}
+
+	var name string
+	switch t := schema.Type.(type) {
+	case string:
+		name = t
+	case []any:
+		types := make([]string, len(t))
+		for i, v := range t {
+			types[i] = fmt.Sprint(v)
+		}
+		name = strings.Join(types, " or ")
+	default:
+		return "any"
+	}
+
+	if name == "array" && schema.Items != nil {
+		name = "array of " + schemaType(schema.Items)
+	}
+	if schema.Format != "" {
+		name += " (" + schema.Format + ")"
+	}
+	return name
+}
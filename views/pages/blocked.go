@@ -0,0 +1,84 @@
+package pages
+
+import (
+	"net/http"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+// BlockedProps holds the data rendered by the blocked page
+type BlockedProps struct {
+	Title   string
+	Message string
+	Reason  string // Optional explanation given by an administrator
+}
+
+// Blocked explains why the visitor can't use the application, with a 403 status
+func Blocked(w http.ResponseWriter, r *http.Request, props BlockedProps) error {
+	page := layouts.Base(nil, r, props.Title+" - French Software",
+		html.Div(
+			attr.Class("max-w-xl mx-auto px-8 py-16"),
+			ui.Card(
+				ui.CardHeader(ui.CardHeaderProps{
+					Title:       props.Title,
+					Description: props.Message,
+				}),
+				html.If(props.Reason != "",
+					ui.CardSection(
+						html.Div(
+							attr.Class("alert-destructive"),
+							html.I(html.Attr("data-lucide", "ban")),
+							html.H2(html.Text("Reason")),
+							html.Section(html.Text(props.Reason)),
+						),
+					),
+				),
+				ui.CardFooter(
+					html.A(
+						attr.Href(router.URL(routes.Home)),
+						attr.Class("btn-outline"),
+						html.Text("Back to home"),
+					),
+				),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	return page.Render(w)
+}
+
+// AccountDisabled tells a disabled user their account was suspended
+func AccountDisabled(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	props := BlockedProps{
+		Title:   "Account suspended",
+		Message: "Your account has been suspended by an administrator. Contact support if you think this is a mistake.",
+	}
+	if user.DisabledReason != nil {
+		props.Reason = *user.DisabledReason
+	}
+	return Blocked(w, r, props)
+}
+
+// EmailInUse tells a visitor their Google email is the contact email of another account
+func EmailInUse(w http.ResponseWriter, r *http.Request) error {
+	return Blocked(w, r, BlockedProps{
+		Title:   "Email address already in use",
+		Message: "Another account uses this email address as its contact email. Sign in with that account, or change its email address in its settings first.",
+	})
+}
+
+// SignUpNotAllowed tells a visitor their email domain can't create an account
+func SignUpNotAllowed(w http.ResponseWriter, r *http.Request) error {
+	return Blocked(w, r, BlockedProps{
+		Title:   "Sign up not allowed",
+		Message: "Accounts can't be created with this email address. Try signing in with another Google account.",
+	})
+}
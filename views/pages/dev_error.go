@@ -0,0 +1,159 @@
+package pages
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/views/components"
+)
+
+// DevError renders the details of a server error for developers, only used in development.
+// It doesn't use the base layout so that it still renders when the layout is what fails.
+func DevError(w http.ResponseWriter, r *http.Request, info *router.DebugInfo) error {
+	title := "Error"
+	if info.Panic {
+		title = "Panic"
+	}
+
+	// Sections are built conditionally as html.If evaluates its children eagerly
+	sections := []any{attr.Class("max-w-5xl mx-auto px-8 py-8 flex flex-col gap-8")}
+	sections = append(sections, html.Div(
+		html.P(
+			attr.Class("text-sm text-muted-foreground mb-2"),
+			html.Text(fmt.Sprintf("%s %d · %s %s", title, info.Status, info.Method, info.URL)),
+		),
+		html.H1(attr.Class("text-2xl font-semibold break-words"), html.Text(info.Chain[0])),
+	))
+
+	if len(info.Chain) > 1 {
+		sections = append(sections, devSection("Error chain",
+			html.Ol(
+				attr.Class("flex flex-col gap-1 font-mono text-sm"),
+				html.Map(info.Chain, func(message string) html.Node {
+					return html.Li(attr.Class("break-words"), html.Text(message))
+				}),
+			),
+		))
+	}
+
+	if len(info.Stack) > 0 {
+		sections = append(sections, devSection("Stack trace",
+			html.Div(
+				attr.Class("flex flex-col gap-2"),
+				html.Map(info.Stack, devStackFrame),
+			),
+		))
+	}
+
+	sections = append(sections,
+		devSection("Request",
+			devTable([][2]string{
+				{"Request ID", info.RequestID},
+				{"Method", info.Method},
+				{"URL", info.URL},
+				{"Protocol", info.Proto},
+				{"Client IP", info.ClientIP},
+			}),
+		),
+		devSection("Headers",
+			devTable(func() [][2]string {
+				rows := make([][2]string, len(info.Headers))
+				for i, header := range info.Headers {
+					rows[i] = [2]string{header.Name, header.Value}
+				}
+				return rows
+			}()),
+		),
+	)
+
+	page := html.Document(
+		html.Html(
+			attr.Lang("en"),
+			html.Head(
+				html.Title(html.Text(title+": "+info.Chain[0])),
+				html.Meta(attr.Charset("utf-8")),
+				html.Meta(attr.Name("viewport"), attr.Content("width=device-width, initial-scale=1")),
+				html.Link(attr.Rel("stylesheet"), attr.Href("/styles.css")),
+				components.HotReloadScript(),
+			),
+			html.Body(
+				attr.Class("font-sans min-h-screen"),
+				html.Div(sections...),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(info.Status)
+	return page.Render(w)
+}
+
+// devSection renders a titled section of the developer error page
+func devSection(title string, content html.Node) html.Node {
+	return html.Section(
+		html.H2(attr.Class("text-lg font-semibold mb-3"), html.Text(title)),
+		content,
+	)
+}
+
+// devStackFrame renders a stack frame, with its source when it belongs to the application
+func devStackFrame(frame router.StackFrame) html.Node {
+	location := frame.File + ":" + strconv.Itoa(frame.Line)
+
+	summary := html.Summary(
+		attr.Class("cursor-pointer px-3 py-2 font-mono text-sm"),
+		html.Div(
+			html.IfElse(frame.App,
+				html.Strong(html.Text(frame.Function)),
+				html.Span(attr.Class("text-muted-foreground"), html.Text(frame.Function)),
+			),
+		),
+		html.Div(attr.Class("text-xs text-muted-foreground break-all"), html.Text(location)),
+	)
+
+	args := []any{attr.Class("border rounded-md")}
+	if frame.App {
+		args = append(args, html.Attr("open", ""))
+	}
+	args = append(args, summary)
+	if len(frame.Source) > 0 {
+		args = append(args, html.Pre(
+			attr.Class("border-t overflow-x-auto py-2 text-xs"),
+			html.Map(frame.Source, func(line router.SourceLine) html.Node {
+				class := "block px-3"
+				if line.Current {
+					class += " bg-destructive/15 font-semibold"
+				}
+				return html.Code(
+					attr.Class(class),
+					html.Span(
+						attr.Class("inline-block w-12 select-none text-muted-foreground"),
+						html.Text(strconv.Itoa(line.Number)),
+					),
+					html.Text(line.Text),
+				)
+			}),
+		))
+	}
+
+	return html.Details(args...)
+}
+
+// devTable renders name and value pairs
+func devTable(rows [][2]string) html.Node {
+	return html.Table(
+		attr.Class("table"),
+		html.Tbody(
+			html.Map(rows, func(row [2]string) html.Node {
+				return html.Tr(
+					html.Td(attr.Class("font-medium whitespace-nowrap align-top"), html.Text(row[0])),
+					html.Td(attr.Class("font-mono text-sm break-all"), html.Text(row[1])),
+				)
+			}),
+		),
+	)
+}
@@ -0,0 +1,86 @@
+package pages
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+// Error renders the error page of an HTTP error, used for every error shown to browsers
+func Error(w http.ResponseWriter, r *http.Request, err *router.HTTPError) error {
+	title, message := errorText(err)
+
+	// Server errors come with the request ID to help support find the logs
+	var details html.Node = html.Group()
+	if requestID := r.Header.Get("X-Request-ID"); err.Code >= 500 && requestID != "" {
+		details = ui.CardSection(
+			html.P(
+				attr.Class("text-sm text-muted-foreground"),
+				html.Text("Request ID: "),
+				html.Code(html.Text(requestID)),
+			),
+		)
+	}
+
+	page := layouts.Base(auth.GetCurrentUser(r), r, title+" - French Software",
+		html.Div(
+			attr.Class("max-w-xl mx-auto px-8 py-16"),
+			ui.Card(
+				ui.CardHeader(ui.CardHeaderProps{
+					Title:       title,
+					Description: message,
+				}),
+				details,
+				ui.CardFooter(
+					html.A(
+						attr.Href(router.URL(routes.Home)),
+						attr.Class("btn-outline"),
+						html.Text("Back to home"),
+					),
+				),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(err.Code)
+	return page.Render(w)
+}
+
+// errorText returns the title and message shown for an error
+func errorText(err *router.HTTPError) (string, string) {
+	switch err.Code {
+	case http.StatusNotFound:
+		return "Page not found", "The page you are looking for doesn't exist or has been moved."
+	case http.StatusForbidden:
+		return "Access denied", "You don't have permission to access this page."
+	case http.StatusTooManyRequests:
+		return "Too many requests", "You're going a bit fast. Wait a moment and try again."
+	}
+
+	if err.Code >= 500 {
+		return "Something went wrong", "An unexpected error occurred on our side. Try again in a few moments."
+	}
+
+	// Client errors carry a message meant for the user
+	title := http.StatusText(err.Code)
+	if title == "" {
+		title = "Error"
+	}
+	return title, capitalize(err.Message)
+}
+
+// capitalize uppercases the first letter of an error message
+func capitalize(message string) string {
+	if message == "" {
+		return message
+	}
+	return strings.ToUpper(message[:1]) + message[1:]
+}
@@ -2,11 +2,16 @@ package pages
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/frenchsoftware/libhtml/attr"
 	"github.com/frenchsoftware/libhtml/html"
 	"github.com/frenchsoftware/libvalidator/validator"
 	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/routes"
 	"github.com/hyperstitieux/template/views"
 	"github.com/hyperstitieux/template/views/components/ui"
 	"github.com/hyperstitieux/template/views/layouts"
@@ -26,16 +31,25 @@ func Home(w http.ResponseWriter, r *http.Request) error {
 	return page.Render(w)
 }
 
-func Settings(w http.ResponseWriter, r *http.Request) error {
-	return SettingsWithErrors(w, r, nil)
+// SettingsProps holds the data rendered by the settings page
+type SettingsProps struct {
+	Errors        validator.ValidationErrors
+	DataExport    *models.DataExport // Latest data export, nil if none was requested
+	DataExportURL string             // Signed download URL when the export is ready
+
+	DeletionGracePeriod time.Duration // Time during which a deleted account can be restored
 }
 
-func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) error {
+func Settings(w http.ResponseWriter, r *http.Request, props SettingsProps) error {
+	errs := props.Errors
+	graceDays := strconv.Itoa(int(props.DeletionGracePeriod.Hours() / 24))
+	impersonating := auth.IsImpersonating(r)
+
 	// Get authenticated user from context (required for settings page)
 	user := views.GetUser(r)
 	if user == nil {
 		// Redirect to OAuth with return URL
-		http.Redirect(w, r, "/auth/google?redirect=/settings", http.StatusTemporaryRedirect)
+		http.Redirect(w, r, routes.SignIn(router.URL(routes.Settings)), http.StatusTemporaryRedirect)
 		return nil
 	}
 
@@ -65,7 +79,7 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 				// General settings form
 				html.Form(
 					attr.Id("profile-form"),
-					attr.Action("/settings/update-profile"),
+					attr.Action(router.URL(routes.SettingsUpdateProfile)),
 					attr.Method("POST"),
 
 					ui.Card(
@@ -74,28 +88,6 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 							Description: "Update your personal information",
 						}),
 						ui.CardSection(
-							// Email field (readonly)
-							html.Div(
-								attr.Class("flex flex-col gap-2"),
-								html.Label(
-									attr.For("email"),
-									attr.Class("text-sm font-medium"),
-									html.Text("Email"),
-								),
-								html.Input(
-									attr.Type("email"),
-									attr.Id("email"),
-									attr.Name("email"),
-									attr.Value(user.Email),
-									attr.Readonly("true"),
-									attr.Class("input bg-muted text-muted-foreground cursor-not-allowed"),
-								),
-								html.P(
-									attr.Class("text-xs text-muted-foreground"),
-									html.Text("Your email address cannot be changed"),
-								),
-							),
-
 							// Name field
 							html.Div(
 								attr.Class("flex flex-col gap-2"),
@@ -131,6 +123,105 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 					),
 				),
 
+				// Email settings form
+				html.Form(
+					attr.Id("email-form"),
+					attr.Action(router.URL(routes.SettingsChangeEmail)),
+					attr.Method("POST"),
+
+					ui.Card(
+						ui.CardHeader(ui.CardHeaderProps{
+							Title:       "Email",
+							Description: "The address we use to contact you",
+						}),
+						ui.CardSection(
+							html.Div(
+								attr.Class("flex flex-col gap-2"),
+								html.Label(
+									attr.For("email"),
+									attr.Class("text-sm font-medium"),
+									html.Text("Email"),
+								),
+								html.Input(
+									attr.Type("email"),
+									attr.Id("email"),
+									attr.Name("email"),
+									attr.Value(user.Email),
+									attr.Required("true"),
+									attr.Maxlength("254"),
+									attr.ClassIfElse(errs != nil && errs.Has("email"), "input border-destructive focus:ring-destructive", "input"),
+								),
+								html.If(errs != nil && errs.Has("email"),
+									html.P(
+										attr.Class("text-xs text-destructive"),
+										html.Text(errs.Get("email")),
+									),
+								),
+								html.P(
+									attr.Class("text-xs text-muted-foreground"),
+									html.Text("We will send a verification link to the new address before the change takes effect"),
+								),
+								html.If(user.HasCustomEmail() && user.ProviderEmail != user.Email,
+									html.P(
+										attr.Class("text-xs text-muted-foreground"),
+										html.Text("Your Google account uses "+user.ProviderEmail),
+									),
+								),
+							),
+							html.If(user.PendingEmail != nil,
+								html.Div(
+									attr.Class("alert"),
+									html.I(html.Attr("data-lucide", "mail")),
+									html.H2(html.Text("Verification pending")),
+									html.Section(
+										html.Text("Check the inbox of "+pendingEmail(user.PendingEmail)+" to confirm the change"),
+									),
+								),
+							),
+						),
+						ui.CardFooter(
+							html.Button(
+								attr.Type("submit"),
+								attr.Class("btn-primary"),
+								html.Text("Change email"),
+							),
+						),
+					),
+				),
+
+				// Data export card
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Your data",
+						Description: "Download a copy of everything we store about you",
+					}),
+					ui.CardSection(
+						dataExportStatus(props.DataExport),
+					),
+					ui.CardFooter(
+						html.If(props.DataExportURL != "" && !impersonating,
+							html.A(
+								attr.Href(props.DataExportURL),
+								attr.Class("btn-primary"),
+								html.Text("Download archive"),
+							),
+						),
+						html.If(!impersonating,
+							html.Form(
+								attr.Action(router.URL(routes.DataExport)),
+								attr.Method("POST"),
+								dataExportButton(props),
+							),
+						),
+						html.If(impersonating,
+							html.P(
+								attr.Class("text-sm text-muted-foreground"),
+								html.Text("Archives can't be requested or downloaded while impersonating."),
+							),
+						),
+					),
+				),
+
 				// Danger zone card
 				ui.Card(
 					ui.CardHeader(ui.CardHeaderProps{
@@ -149,7 +240,7 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 									),
 									html.P(
 										attr.Class("text-sm text-muted-foreground"),
-										html.Text("Permanently delete your account and all associated data"),
+										html.Text("Permanently delete your account and all associated data after a "+graceDays+" days grace period"),
 									),
 								),
 								html.Button(
@@ -169,7 +260,7 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 		ui.AlertDialog(ui.AlertDialogProps{
 			ID:          "delete-account-dialog",
 			Title:       "Are you absolutely sure?",
-			Description: "This action cannot be undone. This will permanently delete your account and remove all your data from our servers.",
+			Description: "You will be signed out and your account will be permanently deleted in " + graceDays + " days, along with all your data. Sign in again before then to restore it.",
 			Footer: html.Div(
 				attr.Class("flex gap-2"),
 				html.Button(
@@ -179,7 +270,7 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 					html.Text("Cancel"),
 				),
 				html.Form(
-					attr.Action("/settings/delete-account"),
+					attr.Action(router.URL(routes.SettingsDeleteAccount)),
 					attr.Method("POST"),
 					attr.Class("inline"),
 					html.Button(
@@ -196,3 +287,46 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	return page.Render(w)
 }
+
+// pendingEmail dereferences the pending email for display
+func pendingEmail(email *string) string {
+	if email == nil {
+		return ""
+	}
+	return *email
+}
+
+// dataExportStatus describes the state of the latest data export
+func dataExportStatus(dataExport *models.DataExport) html.Node {
+	var message string
+	switch {
+	case dataExport == nil:
+		message = "We will prepare a ZIP archive of your profile, linked accounts and activity, and email you when it's ready."
+	case dataExport.Status == models.DataExportPending:
+		message = "We're preparing your archive. You will receive an email when it's ready."
+	case dataExport.Status == models.DataExportFailed:
+		message = "Your last export failed. Please try again."
+	case dataExport.IsDownloadable():
+		message = "Your archive is ready and available until " + dataExport.ExpiresAt.Format("Mon 2 Jan 2006 15:04") + "."
+	default:
+		message = "Your last archive has expired. You can request a new one."
+	}
+
+	return html.P(
+		attr.Class("text-sm text-muted-foreground"),
+		html.Text(message),
+	)
+}
+
+// dataExportButton renders the export request button, disabled while an export is pending
+func dataExportButton(props SettingsProps) html.Node {
+	args := []any{
+		attr.Type("submit"),
+		attr.ClassIfElse(props.DataExportURL != "", "btn-outline", "btn-primary"),
+		html.Text("Download my data"),
+	}
+	if props.DataExport != nil && props.DataExport.Status == models.DataExportPending {
+		args = append(args, attr.Disabled("true"))
+	}
+	return html.Button(args...)
+}